@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Direction of a transfer as seen from the host
+type Direction string
+
+const (
+	DirectionIn  = Direction("IN")  // Dongle to host
+	DirectionOut = Direction("OUT") // Host to dongle
+)
+
+// Chunk is a piece of bulk transfer data read from a capture
+type Chunk struct {
+	Time      time.Time // Zero for raw dumps
+	Offset    int64     // Byte offset in the capture file
+	Direction Direction
+	Device    string // "bus.dev" for usbmon captures, "" for raw dumps
+	Data      []byte
+	Truncated bool // The capture cut off part of the transfer
+}
+
+// CaptureReader yields bulk transfer data in capture order
+type CaptureReader interface {
+	Next() (*Chunk, error)
+}
+
+// rawReader reads a plain dump of bulk data in a single direction
+type rawReader struct {
+	r         *bufio.Reader
+	direction Direction
+	offset    int64
+}
+
+func newRawReader(r io.Reader, direction Direction) *rawReader {
+	return &rawReader{r: bufio.NewReader(r), direction: direction}
+}
+
+func (r *rawReader) Next() (*Chunk, error) {
+	buf := make([]byte, 64*1024)
+	n, err := r.r.Read(buf)
+	if n == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	chunk := &Chunk{Offset: r.offset, Direction: r.direction, Data: buf[:n]}
+	r.offset += int64(n)
+	return chunk, nil
+}
+
+const (
+	pcapMagicMicro        = 0xa1b2c3d4
+	pcapMagicNano         = 0xa1b23c4d
+	pcapngMagic           = 0x0a0d0d0a
+	linkTypeUSBLinux      = 189 // usbmon, 48-byte header
+	linkTypeUSBLinuxMmap  = 220 // usbmon, 64-byte header
+	usbmonTransferBulk    = 3
+	usbmonEventSubmit     = 'S'
+	usbmonEventComplete   = 'C'
+	usbmonEndpointDirIn   = 0x80
+	pcapRecordHeaderSize  = 16
+	pcapGlobalHeaderSize  = 24
+	usbmonHeaderSize      = 48
+	usbmonMmapHeaderSize  = 64
+	maxPcapRecordCapacity = 16 * 1024 * 1024
+)
+
+// pcapReader reads bulk transfers from a usbmon pcap capture
+type pcapReader struct {
+	r          *bufio.Reader
+	order      binary.ByteOrder
+	nano       bool
+	headerSize int
+	offset     int64
+}
+
+// isPcap reports whether the capture starts with a pcap or pcapng magic number
+func isPcap(head []byte) bool {
+	if len(head) < 4 {
+		return false
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(head) {
+		case pcapMagicMicro, pcapMagicNano, pcapngMagic:
+			return true
+		}
+	}
+	return false
+}
+
+func newPcapReader(r io.Reader) (*pcapReader, error) {
+	p := &pcapReader{r: bufio.NewReader(r)}
+
+	header := make([]byte, pcapGlobalHeaderSize)
+	if _, err := io.ReadFull(p.r, header); err != nil {
+		return nil, fmt.Errorf("reading pcap header: %v", err)
+	}
+	p.offset = pcapGlobalHeaderSize
+
+	switch {
+	case binary.LittleEndian.Uint32(header) == pcapMagicMicro:
+		p.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header) == pcapMagicMicro:
+		p.order = binary.BigEndian
+	case binary.LittleEndian.Uint32(header) == pcapMagicNano:
+		p.order, p.nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(header) == pcapMagicNano:
+		p.order, p.nano = binary.BigEndian, true
+	case binary.LittleEndian.Uint32(header) == pcapngMagic:
+		return nil, errors.New("pcapng is not supported, convert with: editcap -F pcap in.pcapng out.pcap")
+	default:
+		return nil, errors.New("not a pcap file")
+	}
+
+	switch linkType := p.order.Uint32(header[20:]); linkType {
+	case linkTypeUSBLinux:
+		p.headerSize = usbmonHeaderSize
+	case linkTypeUSBLinuxMmap:
+		p.headerSize = usbmonMmapHeaderSize
+	default:
+		return nil, fmt.Errorf("unsupported pcap link type %d, expected a usbmon capture", linkType)
+	}
+	return p, nil
+}
+
+func (p *pcapReader) Next() (*Chunk, error) {
+	for {
+		record := make([]byte, pcapRecordHeaderSize)
+		if _, err := io.ReadFull(p.r, record); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		offset := p.offset
+		seconds := p.order.Uint32(record[0:])
+		fraction := p.order.Uint32(record[4:])
+		captured := p.order.Uint32(record[8:])
+		if captured > maxPcapRecordCapacity {
+			return nil, fmt.Errorf("corrupt pcap record at offset %d: length %d", offset, captured)
+		}
+
+		packet := make([]byte, captured)
+		if _, err := io.ReadFull(p.r, packet); err != nil {
+			return nil, io.EOF
+		}
+		p.offset += pcapRecordHeaderSize + int64(captured)
+
+		if len(packet) < p.headerSize {
+			continue
+		}
+		// The usbmon header is stored in the byte order of the capturing host,
+		// which is little endian on all platforms the dongle is used with
+		event := packet[8]
+		transfer := packet[9]
+		endpoint := packet[10]
+		device := packet[11]
+		bus := binary.LittleEndian.Uint16(packet[12:])
+		length := binary.LittleEndian.Uint32(packet[32:])
+		dataLength := binary.LittleEndian.Uint32(packet[36:])
+		if transfer != usbmonTransferBulk || dataLength == 0 {
+			continue
+		}
+
+		// OUT data is captured on submission, IN data on completion
+		direction := DirectionOut
+		wantEvent := byte(usbmonEventSubmit)
+		if endpoint&usbmonEndpointDirIn != 0 {
+			direction = DirectionIn
+			wantEvent = usbmonEventComplete
+		}
+		if event != wantEvent {
+			continue
+		}
+
+		data := packet[p.headerSize:]
+		if uint32(len(data)) > dataLength {
+			data = data[:dataLength]
+		}
+
+		nanos := int64(fraction) * 1000
+		if p.nano {
+			nanos = int64(fraction)
+		}
+		return &Chunk{
+			Time:      time.Unix(int64(seconds), nanos),
+			Offset:    offset,
+			Direction: direction,
+			Device:    fmt.Sprintf("%d.%d", bus, device),
+			Data:      data,
+			Truncated: uint32(len(data)) < length,
+		}, nil
+	}
+}
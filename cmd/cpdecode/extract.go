@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// videoWriter writes the H.264 elementary stream of VideoData messages
+type videoWriter struct {
+	file   *os.File
+	frames int
+	bytes  int64
+}
+
+func newVideoWriter(path string) (*videoWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &videoWriter{file: file}, nil
+}
+
+func (v *videoWriter) write(video *protocol.VideoData) error {
+	if len(video.Data) == 0 {
+		return nil
+	}
+	n, err := v.file.Write(video.Data)
+	v.frames++
+	v.bytes += int64(n)
+	return err
+}
+
+func (v *videoWriter) Close() error {
+	return v.file.Close()
+}
+
+// audioKey identifies an audio stream: the dongle interleaves channels
+// (media, navigation, call) which may use different formats
+type audioKey struct {
+	direction  Direction
+	audioType  int32
+	decodeType protocol.DecodeType
+}
+
+// audioWriter writes the PCM of AudioData messages into one WAV file per stream
+type audioWriter struct {
+	base    string
+	streams map[audioKey]*wavFile
+}
+
+func newAudioWriter(path string) *audioWriter {
+	return &audioWriter{
+		base:    strings.TrimSuffix(path, ".wav"),
+		streams: make(map[audioKey]*wavFile),
+	}
+}
+
+func (a *audioWriter) write(direction Direction, audio *protocol.AudioData) error {
+	if len(audio.Data) == 0 {
+		return nil
+	}
+	format, ok := protocol.AudioDecodeTypes[audio.DecodeType]
+	if !ok || format.Frequency == 0 {
+		return fmt.Errorf("unknown audio decode type %d", audio.DecodeType)
+	}
+
+	key := audioKey{direction, audio.AudioType, audio.DecodeType}
+	wav, ok := a.streams[key]
+	if !ok {
+		path := fmt.Sprintf("%s-%s-%d-%d.wav", a.base, strings.ToLower(string(direction)), audio.AudioType, audio.DecodeType)
+		var err error
+		wav, err = createWav(path, format)
+		if err != nil {
+			return err
+		}
+		a.streams[key] = wav
+	}
+	return wav.write(audio.Data)
+}
+
+func (a *audioWriter) files() []*wavFile {
+	files := make([]*wavFile, 0, len(a.streams))
+	for _, wav := range a.streams {
+		files = append(files, wav)
+	}
+	return files
+}
+
+func (a *audioWriter) Close() error {
+	var firstErr error
+	for _, wav := range a.streams {
+		if err := wav.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+const wavHeaderSize = 44
+
+// wavFile is a PCM WAV file whose sizes are filled in on Close
+type wavFile struct {
+	path   string
+	file   *os.File
+	format protocol.AudioFormat
+	size   uint32
+}
+
+func createWav(path string, format protocol.AudioFormat) (*wavFile, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	wav := &wavFile{path: path, file: file, format: format}
+	if err := wav.writeHeader(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return wav, nil
+}
+
+func (w *wavFile) writeHeader() error {
+	blockAlign := w.format.Channel * w.format.Bitrate / 8
+	header := make([]byte, wavHeaderSize)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], 36+w.size)
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16) // fmt chunk size
+	binary.LittleEndian.PutUint16(header[20:], 1)  // PCM
+	binary.LittleEndian.PutUint16(header[22:], w.format.Channel)
+	binary.LittleEndian.PutUint32(header[24:], uint32(w.format.Frequency))
+	binary.LittleEndian.PutUint32(header[28:], uint32(w.format.Frequency)*uint32(blockAlign))
+	binary.LittleEndian.PutUint16(header[32:], blockAlign)
+	binary.LittleEndian.PutUint16(header[34:], w.format.Bitrate)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], w.size)
+	_, err := w.file.WriteAt(header, 0)
+	return err
+}
+
+func (w *wavFile) write(pcm []byte) error {
+	_, err := w.file.WriteAt(pcm, int64(wavHeaderSize)+int64(w.size))
+	w.size += uint32(len(pcm))
+	return err
+}
+
+func (w *wavFile) Close() error {
+	if err := w.writeHeader(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,267 @@
+// Command cpdecode decodes captured dongle traffic.
+//
+// It reads either a raw dump of bulk transfer data or a usbmon pcap capture
+// (e.g. from `tcpdump -i usbmon1 -w capture.pcap` or Wireshark), prints the
+// decoded message stream and optionally extracts video and audio:
+//
+//	cpdecode capture.pcap
+//	cpdecode -video out.h264 -audio out.wav -media=false capture.pcap
+//	cpdecode -navi-video navi.h264 -type NaviFocusRequest,NaviFocusRelease capture.pcap
+//	cpdecode -format raw -dir in bulk-in.bin
+//
+// Audio streams are written to one file per direction, audio type and decode
+// type, e.g. out-in-1-2.wav for 48 kHz stereo media received from the dongle.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+type options struct {
+	format    string
+	direction string
+	device    string
+	types     map[string]bool
+	media     bool
+	video     string
+	naviVideo string
+	audio     string
+}
+
+func main() {
+	var opts options
+	var types string
+	flag.StringVar(&opts.format, "format", "auto", "capture format: auto, raw or pcap")
+	flag.StringVar(&opts.direction, "dir", "in", "direction of raw dumps: in (dongle to host) or out")
+	flag.StringVar(&opts.device, "device", "", "only decode this usbmon device, as bus.dev (e.g. 1.5)")
+	flag.StringVar(&types, "type", "", "only print these message types, comma separated (e.g. Command,Touch)")
+	flag.BoolVar(&opts.media, "media", true, "print VideoData, NaviVideoData and AudioData messages")
+	flag.StringVar(&opts.video, "video", "", "write received H.264 video to this file")
+	flag.StringVar(&opts.naviVideo, "navi-video", "", "write received H.264 navigation video to this file")
+	flag.StringVar(&opts.audio, "audio", "", "write audio PCM to WAV files named after this file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <capture>\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if types != "" {
+		opts.types = make(map[string]bool)
+		for _, t := range strings.Split(types, ",") {
+			opts.types[strings.ToLower(strings.TrimSpace(t))] = true
+		}
+	}
+
+	if err := run(flag.Arg(0), opts); err != nil {
+		fmt.Fprintf(os.Stderr, "cpdecode: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(path string, opts options) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := openCapture(file, opts)
+	if err != nil {
+		return err
+	}
+
+	var video *videoWriter
+	if opts.video != "" {
+		if video, err = newVideoWriter(opts.video); err != nil {
+			return err
+		}
+		defer video.Close()
+	}
+	var naviVideo *videoWriter
+	if opts.naviVideo != "" {
+		if naviVideo, err = newVideoWriter(opts.naviVideo); err != nil {
+			return err
+		}
+		defer naviVideo.Close()
+	}
+	var audio *audioWriter
+	if opts.audio != "" {
+		audio = newAudioWriter(opts.audio)
+		defer audio.Close()
+	}
+
+	streams := make(map[string]*stream)
+	counts := make(map[string]int)
+	var start time.Time
+
+	for {
+		chunk, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if opts.device != "" && chunk.Device != opts.device {
+			continue
+		}
+
+		key := chunk.Device + " " + string(chunk.Direction)
+		s, ok := streams[key]
+		if !ok {
+			s = &stream{direction: chunk.Direction, device: chunk.Device}
+			streams[key] = s
+		}
+
+		for _, msg := range s.feed(chunk) {
+			if start.IsZero() {
+				start = msg.Time
+			}
+			name := protocol.MessageName(msg.Payload)
+			counts[name]++
+
+			switch payload := msg.Payload.(type) {
+			case *protocol.VideoData:
+				if video != nil && msg.Direction == DirectionIn {
+					if err := video.write(payload); err != nil {
+						return err
+					}
+				}
+			case *protocol.NaviVideoData:
+				if naviVideo != nil && msg.Direction == DirectionIn {
+					if err := naviVideo.write((*protocol.VideoData)(payload)); err != nil {
+						return err
+					}
+				}
+			case *protocol.AudioData:
+				if audio != nil {
+					if err := audio.write(msg.Direction, payload); err != nil {
+						fmt.Fprintf(os.Stderr, "cpdecode: audio at offset %d: %v\n", msg.Offset, err)
+					}
+				}
+			}
+
+			if opts.show(name, msg.Payload) {
+				printMessage(msg, name, start)
+			}
+		}
+
+		if chunk.Truncated {
+			// The rest of the transfer is missing from the capture
+			fmt.Fprintf(os.Stderr, "cpdecode: truncated transfer at offset %d, increase the capture snaplen\n", chunk.Offset)
+			s.reset()
+		}
+	}
+
+	printSummary(streams, counts, video, naviVideo, audio)
+	return nil
+}
+
+// openCapture detects the capture format and returns its reader
+func openCapture(file *os.File, opts options) (CaptureReader, error) {
+	format := opts.format
+	if format == "auto" {
+		head := make([]byte, 4)
+		n, _ := io.ReadFull(file, head)
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		format = "raw"
+		if isPcap(head[:n]) {
+			format = "pcap"
+		}
+	}
+
+	switch format {
+	case "pcap":
+		return newPcapReader(file)
+	case "raw":
+		switch strings.ToLower(opts.direction) {
+		case "in":
+			return newRawReader(file, DirectionIn), nil
+		case "out":
+			return newRawReader(file, DirectionOut), nil
+		}
+		return nil, fmt.Errorf("invalid direction %q, expected in or out", opts.direction)
+	}
+	return nil, fmt.Errorf("invalid format %q, expected auto, raw or pcap", opts.format)
+}
+
+// show reports whether a message passes the type and media filters
+func (opts options) show(name string, payload interface{}) bool {
+	if !opts.media {
+		switch payload := payload.(type) {
+		case *protocol.VideoData, *protocol.NaviVideoData:
+			return false
+		case *protocol.AudioData:
+			if len(payload.Data) > 0 {
+				return false
+			}
+		}
+	}
+	return opts.types == nil || opts.types[strings.ToLower(name)]
+}
+
+// printMessage prints one decoded message. Raw dumps carry no timestamps,
+// so their messages are located by byte position instead.
+func printMessage(msg *Message, name string, start time.Time) {
+	position := fmt.Sprintf("@%d", msg.Position)
+	if !msg.Time.IsZero() {
+		position = fmt.Sprintf("%.6f", msg.Time.Sub(start).Seconds())
+	}
+	device := ""
+	if msg.Device != "" {
+		device = msg.Device + " "
+	}
+
+	if msg.Err != nil {
+		fmt.Printf("%12s %s%-3s %-20s len=%-7d decode error: %v\n", position, device, msg.Direction, name, msg.Header.Length, msg.Err)
+		return
+	}
+	decoded, _ := protocol.DescribePayload(msg.Payload)
+	fmt.Printf("%12s %s%-3s %-20s len=%-7d %s\n", position, device, msg.Direction, name, msg.Header.Length, decoded)
+}
+
+// printSummary prints message counts and extracted files to stderr
+func printSummary(streams map[string]*stream, counts map[string]int, video, naviVideo *videoWriter, audio *audioWriter) {
+	names := make([]string, 0, len(counts))
+	total := 0
+	for name, count := range counts {
+		names = append(names, name)
+		total += count
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "\n%d messages\n", total)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-20s %d\n", name, counts[name])
+	}
+	for key, s := range streams {
+		if s.skipped > 0 {
+			fmt.Fprintf(os.Stderr, "%s: skipped %d bytes while resynchronizing\n", strings.TrimSpace(key), s.skipped)
+		}
+	}
+	if video != nil {
+		fmt.Fprintf(os.Stderr, "Video: %d frames, %d bytes\n", video.frames, video.bytes)
+	}
+	if naviVideo != nil {
+		fmt.Fprintf(os.Stderr, "Navigation video: %d frames, %d bytes\n", naviVideo.frames, naviVideo.bytes)
+	}
+	if audio != nil {
+		for _, wav := range audio.files() {
+			fmt.Fprintf(os.Stderr, "Audio: %s (%d Hz, %d ch, %d bytes)\n", wav.path, wav.format.Frequency, wav.format.Channel, wav.size)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+const (
+	headerSize = 16
+	// maxPayloadLength rejects headers whose length is implausible, so a
+	// corrupt header does not stall decoding while waiting for data
+	maxPayloadLength = 4 * 1024 * 1024
+)
+
+var magic = []byte{0xaa, 0x55, 0xaa, 0x55}
+
+// Message is a decoded message reassembled from bulk transfers
+type Message struct {
+	Time      time.Time
+	Offset    int64 // Capture file offset of the chunk holding the header
+	Position  int64 // Byte position of the header within its stream
+	Direction Direction
+	Device    string
+	Header    protocol.Header
+	Payload   interface{}
+	Err       error // Set if the payload could not be decoded
+}
+
+// stream reassembles messages of one direction of one device
+type stream struct {
+	buf       bytes.Buffer
+	time      time.Time // Time of the chunk holding the pending message header
+	offset    int64
+	direction Direction
+	device    string
+	position  int64 // Stream bytes consumed so far
+	skipped   int   // Bytes dropped while searching for a header
+}
+
+// feed appends a chunk and returns the messages it completes
+func (s *stream) feed(chunk *Chunk) []*Message {
+	if s.buf.Len() == 0 {
+		s.time, s.offset = chunk.Time, chunk.Offset
+	}
+	s.buf.Write(chunk.Data)
+
+	var messages []*Message
+	for s.buf.Len() >= headerSize {
+		data := s.buf.Bytes()
+		var hdr protocol.Header
+		if err := protocol.Unmarshal(data[:headerSize], &hdr); err != nil || hdr.Length > maxPayloadLength {
+			s.resync()
+			continue
+		}
+		if len(data) < headerSize+int(hdr.Length) {
+			break
+		}
+
+		payloadData := make([]byte, hdr.Length)
+		copy(payloadData, data[headerSize:])
+		s.buf.Next(headerSize + int(hdr.Length))
+
+		msg := &Message{
+			Time:      s.time,
+			Offset:    s.offset,
+			Position:  s.position,
+			Direction: s.direction,
+			Device:    s.device,
+			Header:    hdr,
+			Payload:   payloadFor(hdr, s.direction),
+		}
+		msg.Err = protocol.Unmarshal(payloadData, msg.Payload)
+		messages = append(messages, msg)
+		s.position += headerSize + int64(hdr.Length)
+
+		// Following messages started within this chunk
+		s.time, s.offset = chunk.Time, chunk.Offset
+	}
+	return messages
+}
+
+// resync drops bytes up to the next magic number
+func (s *stream) resync() {
+	data := s.buf.Bytes()
+	next := bytes.Index(data[1:], magic)
+	if next < 0 {
+		// Keep a possible partial magic number at the end
+		next = len(data) - len(magic)
+	}
+	s.skipped += next + 1
+	s.position += int64(next + 1)
+	s.buf.Next(next + 1)
+}
+
+// reset drops pending data, e.g. after a truncated transfer
+func (s *stream) reset() {
+	s.skipped += s.buf.Len()
+	s.position += int64(s.buf.Len())
+	s.buf.Reset()
+}
+
+// payloadFor returns the payload for a header. Open and Opened share a
+// message type and are told apart by direction.
+func payloadFor(hdr protocol.Header, direction Direction) interface{} {
+	if hdr.Type == 0x01 {
+		if direction == DirectionOut {
+			return &protocol.Open{}
+		}
+		return &protocol.Opened{}
+	}
+	return protocol.GetPayloadByHeader(hdr)
+}
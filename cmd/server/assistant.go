@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/mzyy94/gocarplay/link"
+)
+
+// micChunkSize is 40 ms of 16 kHz mono 16-bit PCM
+const micChunkSize = 1280
+
+var assistantManager *link.AssistantManager
+
+var (
+	micCmd   *exec.Cmd
+	micMutex sync.Mutex
+)
+
+// initAssistant sets up the voice assistant button, state publishing and microphone uplink
+func initAssistant() {
+	config := dongleConfig.Assistant
+	mode, err := link.ParseAssistantMode(config.Mode)
+	if err != nil {
+		logger("assistant").Warnf("%v, using tap mode", err)
+		mode = link.AssistantTap
+	}
+
+	assistantManager = link.NewAssistantManager(mode)
+	assistantManager.SetSiriLogo(config.SiriLogo)
+	assistantManager.SetUplinkHandler(func(active bool) {
+		if active {
+			startMicUplink()
+		} else {
+			stopMicUplink()
+		}
+	})
+
+	events := dispatcher.Subscribe()
+	go func() {
+		for event := range events {
+			assistantManager.HandleEvent(event)
+		}
+	}()
+
+	go func() {
+		var last link.AssistantInfo
+		for info := range assistantManager.Subscribe() {
+			if redis == nil {
+				continue
+			}
+			if info.Active != last.Active {
+				redis.PublishState("assistant_active", fmt.Sprintf("%v", info.Active))
+			}
+			if info.MicUplink != last.MicUplink {
+				redis.PublishState("mic_uplink", fmt.Sprintf("%v", info.MicUplink))
+			}
+			last = info
+		}
+	}()
+
+	registerCommand("assistant", func(args []string) error {
+		return assistantManager.Tap()
+	})
+
+	if config.Button != "" {
+		logger("assistant").Infof("Button %s on %s (%s mode)", config.Button, config.ButtonChannel, mode)
+		redis.Subscribe(config.ButtonChannel, func(payload string) {
+			i := strings.LastIndex(payload, ":")
+			if i < 0 || payload[:i] != config.Button {
+				return
+			}
+			switch payload[i+1:] {
+			case "on":
+				if err := assistantManager.Press(); err != nil {
+					logger("assistant").Errorf("Failed to start assistant: %v", err)
+				}
+			case "off":
+				assistantManager.Release()
+			}
+		})
+	}
+}
+
+// startMicUplink starts the configured capture command and sends its audio to the phone
+func startMicUplink() {
+	command := strings.Fields(dongleConfig.Assistant.MicCommand)
+	if len(command) == 0 {
+		return
+	}
+
+	micMutex.Lock()
+	defer micMutex.Unlock()
+	if micCmd != nil {
+		return
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		logger("mic").Errorf("Failed to create pipe: %v", err)
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		logger("mic").Errorf("Failed to start %s: %v", command[0], err)
+		return
+	}
+	micCmd = cmd
+	logger("mic").Info("Uplink started")
+
+	go func() {
+		buf := make([]byte, micChunkSize)
+		for {
+			if _, err := io.ReadFull(stdout, buf); err != nil {
+				break
+			}
+			if err := link.SendMicAudio(buf); err != nil {
+				logger("mic").Errorf("Failed to send audio: %v", err)
+				// Nobody reads the pipe anymore, the command would block forever
+				cmd.Process.Kill()
+				break
+			}
+		}
+		cmd.Wait()
+
+		// Allow the next startMicUplink, unless stopMicUplink already moved on
+		micMutex.Lock()
+		if micCmd == cmd {
+			micCmd = nil
+			logger("mic").Info("Uplink ended")
+		}
+		micMutex.Unlock()
+	}()
+}
+
+// stopMicUplink stops the capture command
+func stopMicUplink() {
+	micMutex.Lock()
+	defer micMutex.Unlock()
+	if micCmd == nil {
+		return
+	}
+	if micCmd.Process != nil {
+		micCmd.Process.Kill()
+	}
+	micCmd = nil
+	logger("mic").Info("Uplink stopped")
+}
+
+// assistantHandler returns the assistant state, or presses/releases the assistant button
+func assistantHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if !dongleReady {
+			http.Error(w, "Dongle not connected", http.StatusServiceUnavailable)
+			return
+		}
+
+		var req struct {
+			Action string `json:"action"` // "tap", "press" or "release"
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		switch req.Action {
+		case "tap", "":
+			err = assistantManager.Tap()
+		case "press":
+			err = assistantManager.Press()
+		case "release":
+			assistantManager.Release()
+		default:
+			http.Error(w, "Invalid action: expected tap, press or release", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger("assistant").Errorf("Error on %s: %v", req.Action, err)
+			http.Error(w, fmt.Sprintf("Failed to start assistant: %v", err), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(assistantManager.GetInfo())
+}
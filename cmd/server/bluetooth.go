@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mzyy94/gocarplay/link"
+)
+
+var bluetoothManager *link.BluetoothManager
+
+// initBluetooth sets up Bluetooth state tracking, publishing and Redis commands
+func initBluetooth() {
+	bluetoothManager = link.NewBluetoothManager()
+	bluetoothManager.SetReorderEnabled(dongleConfig.PairedListReorder)
+	go publishBluetooth(bluetoothManager.Subscribe())
+
+	registerCommand("bt-pair", func(args []string) error {
+		return bluetoothManager.StartPairing()
+	})
+	registerCommand("bt-forget", func(args []string) error {
+		if len(args) != 1 {
+			return errors.New("usage: bt-forget <address>")
+		}
+		return bluetoothManager.Forget(args[0])
+	})
+}
+
+// publishBluetooth publishes changed Bluetooth state to Redis
+func publishBluetooth(updates chan link.BluetoothInfo) {
+	var last link.BluetoothInfo
+	var lastPaired string
+
+	for info := range updates {
+		if redis == nil {
+			continue
+		}
+		if info.Address != last.Address {
+			redis.PublishState("bt_address", info.Address)
+		}
+		if info.Name != last.Name {
+			redis.PublishState("bt_name", info.Name)
+		}
+		if info.PIN != last.PIN {
+			redis.PublishState("bt_pin", info.PIN)
+		}
+		paired, err := json.Marshal(info.Paired)
+		if err == nil && string(paired) != lastPaired {
+			redis.PublishState("bt_paired", string(paired))
+			lastPaired = string(paired)
+		}
+		last = info
+	}
+}
+
+// bluetoothHandler returns the dongle's Bluetooth identity and paired phones
+func bluetoothHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bluetoothManager.GetInfo())
+}
+
+// bluetoothPairHandler puts the dongle into pairing mode
+func bluetoothPairHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !dongleReady {
+		http.Error(w, "Dongle not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := bluetoothManager.StartPairing(); err != nil {
+		logger("bluetooth").Errorf("Error starting pairing: %v", err)
+		http.Error(w, "Failed to start pairing", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// bluetoothForgetHandler removes a phone from the paired list
+func bluetoothForgetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !dongleReady {
+		http.Error(w, "Dongle not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Address string `json:"address"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Address == "" {
+		http.Error(w, "Invalid request: expected {\"address\": ...}", http.StatusBadRequest)
+		return
+	}
+
+	if err := bluetoothManager.Forget(req.Address); err != nil {
+		logger("bluetooth").Errorf("Error forgetting %s: %v", req.Address, err)
+		http.Error(w, fmt.Sprintf("Failed to forget device: %v", err), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/mzyy94/gocarplay/link"
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// publishBoxSettings publishes the dongle-reported dongle and phone info to Redis
+func publishBoxSettings() {
+	if redis == nil {
+		return
+	}
+	info := link.GetBoxSettingsInfo()
+	if info.Box != nil {
+		redis.PublishState("dongle_uuid", info.Box.UUID)
+		redis.PublishState("dongle_product", info.Box.ProductType)
+		redis.PublishState("dongle_hw_version", info.Box.HwVersion)
+	}
+
+	phone := info.Phone
+	if phone == nil {
+		phone = &protocol.PhoneInfo{}
+	}
+	redis.PublishState("phone_model", phone.Model)
+	redis.PublishState("phone_os_version", phone.OSVersion)
+	redis.PublishState("phone_link_type", phone.LinkType)
+	redis.PublishState("phone_bt_mac", phone.BtMacAddr)
+	redis.PublishState("phone_bt_name", phone.BtName)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/mzyy94/gocarplay/link"
+)
+
+var callManager *link.CallManager
+
+// initCalls sets up call-state tracking, publishing and Redis commands
+func initCalls() {
+	callManager = link.NewCallManager()
+
+	events := dispatcher.Subscribe()
+	go func() {
+		for event := range events {
+			callManager.HandleEvent(event)
+		}
+	}()
+
+	go func() {
+		for state := range callManager.Subscribe() {
+			if redis != nil {
+				redis.PublishState("call_state", state.String())
+				redis.PublishState("call_direction", callManager.GetDirection().String())
+			}
+		}
+	}()
+
+	registerCommand("call-accept", func(args []string) error {
+		return callManager.Accept()
+	})
+	registerCommand("call-reject", func(args []string) error {
+		return callManager.Reject()
+	})
+	registerCommand("call-hangup", func(args []string) error {
+		return callManager.HangUp()
+	})
+}
+
+// callHandler returns the current call state
+func callHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"state":     callManager.GetState().String(),
+		"direction": callManager.GetDirection().String(),
+	})
+}
+
+// callActionHandler returns a handler performing a call action
+func callActionHandler(name string, action func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !dongleReady {
+			http.Error(w, "Dongle not connected", http.StatusServiceUnavailable)
+			return
+		}
+
+		if err := action(); err != nil {
+			logger("call").Errorf("Error on %s: %v", name, err)
+			http.Error(w, fmt.Sprintf("Failed to %s: %v", name, err), http.StatusConflict)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// commandHandler handles a Redis command with its space-separated arguments
+type commandHandler func(args []string) error
+
+// rawCommandHandler handles a Redis command with everything after its name, unchanged
+type rawCommandHandler func(payload string) error
+
+// commandHandlers and rawCommandHandlers map Redis command names to their handlers
+var (
+	commandHandlers    = map[string]commandHandler{}
+	rawCommandHandlers = map[string]rawCommandHandler{}
+)
+
+// registerCommand registers a handler for a Redis command
+func registerCommand(name string, handler commandHandler) {
+	commandHandlers[name] = handler
+}
+
+// registerRawCommand registers a handler for a Redis command whose arguments
+// must keep their whitespace, e.g. file contents
+func registerRawCommand(name string, handler rawCommandHandler) {
+	rawCommandHandlers[name] = handler
+}
+
+// handleCommand dispatches a command popped from the Redis command list,
+// e.g. "phone-select AA:BB:CC:DD:EE:FF"
+func handleCommand(command string) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return
+	}
+
+	if handler, ok := rawCommandHandlers[fields[0]]; ok {
+		// Drop the name and the single separator following it
+		payload := strings.TrimLeftFunc(command, unicode.IsSpace)[len(fields[0]):]
+		if payload != "" {
+			payload = payload[1:]
+		}
+		if err := handler(payload); err != nil {
+			logger("command").Warnf("%s failed: %v", fields[0], err)
+		}
+		return
+	}
+
+	handler, ok := commandHandlers[fields[0]]
+	if !ok {
+		logger("command").Warnf("Unknown command: %s", command)
+		return
+	}
+	if err := handler(fields[1:]); err != nil {
+		logger("command").Warnf("%s failed: %v", fields[0], err)
+	}
+}
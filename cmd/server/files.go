@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mzyy94/gocarplay/link"
+)
+
+// initFiles sets up the dongle file API
+func initFiles() {
+	link.AllowFiles(dongleConfig.FileAllowList)
+
+	// The value is passed on unchanged, including runs of spaces and newlines
+	registerRawCommand("dongle-file", func(payload string) error {
+		args := strings.SplitN(payload, " ", 3)
+		if len(args) < 3 {
+			return errors.New("usage: dongle-file <path> <string|int|bool|base64> <value>")
+		}
+		return link.SendDongleFile(args[0], link.FileValueType(args[1]), args[2])
+	})
+}
+
+// filesHandler lists the files written to the dongle, or writes a new one
+func filesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if !dongleReady {
+			http.Error(w, "Dongle not connected", http.StatusServiceUnavailable)
+			return
+		}
+
+		var req struct {
+			Path  string             `json:"path"`
+			Type  link.FileValueType `json:"type"`
+			Value json.RawMessage    `json:"value"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Path == "" {
+			http.Error(w, "Invalid request: expected {\"path\": ..., \"type\": ..., \"value\": ...}", http.StatusBadRequest)
+			return
+		}
+
+		// Accept JSON strings as well as bare numbers and booleans
+		var value string
+		if err := json.Unmarshal(req.Value, &value); err != nil {
+			value = string(req.Value)
+		}
+
+		err := link.SendDongleFile(req.Path, req.Type, value)
+		if err == link.ErrFileNotAllowed {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			logger("files").Errorf("Error writing %s: %v", req.Path, err)
+			http.Error(w, fmt.Sprintf("Failed to write file: %v", err), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(link.SentFiles())
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mzyy94/gocarplay/link"
+)
+
+// publishFirmware publishes the dongle firmware info and compatibility result to Redis
+func publishFirmware() {
+	if redis == nil {
+		return
+	}
+	info := link.GetDongleInfo()
+	redis.PublishState("firmware_version", info.SoftwareVersion)
+	redis.PublishState("manufacturer", fmt.Sprintf("%d/%d", info.ManufacturerA, info.ManufacturerB))
+	redis.PublishState("firmware_disabled_features", strings.Join(info.DisabledFeatures, ","))
+	redis.PublishState("firmware_warning", strings.Join(info.Warnings, "; "))
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mzyy94/gocarplay/link"
+)
+
+// gnssReopenDelay is the wait before reopening the NMEA source after it closes
+const gnssReopenDelay = 5 * time.Second
+
+var gnssForwarder *link.GNSSForwarder
+var gnssStop = make(chan struct{})
+
+// initGNSS forwards GPS fixes from Redis, or NMEA sentences from a serial
+// device or pipe, to the phone
+func initGNSS() {
+	config := dongleConfig.GNSS
+	if !config.Enabled {
+		return
+	}
+	gnssForwarder = link.NewGNSSForwarder(time.Duration(config.Interval) * time.Millisecond)
+
+	switch config.Source {
+	case "", "redis":
+		redis.WatchHash(config.Hash, func(fields map[string]string) {
+			if position, ok := parseGPSHash(fields); ok {
+				gnssForwarder.UpdatePosition(position)
+			}
+		})
+		logger("gnss").Infof("Forwarding GPS fixes from Redis hash %s", config.Hash)
+	case "nmea":
+		if config.Device == "" {
+			logger("gnss").Warn("No NMEA device configured, GNSS forwarding disabled")
+			return
+		}
+		go readNMEA(config.Device)
+		logger("gnss").Infof("Forwarding NMEA sentences from %s", config.Device)
+	default:
+		logger("gnss").Warnf("Unknown GNSS source %q, GNSS forwarding disabled", config.Source)
+	}
+}
+
+// parseGPSHash reads a fix from the GPS hash fields latitude, longitude,
+// altitude, speed (km/h), course and timestamp (RFC 3339)
+func parseGPSHash(fields map[string]string) (link.Position, bool) {
+	number := func(key string) float64 {
+		value, _ := strconv.ParseFloat(fields[key], 64)
+		return value
+	}
+
+	position := link.Position{
+		Time:      time.Now(),
+		Latitude:  number("latitude"),
+		Longitude: number("longitude"),
+		Altitude:  number("altitude"),
+		Speed:     number("speed"),
+		Course:    number("course"),
+	}
+	if fields["latitude"] == "" || fields["longitude"] == "" {
+		return position, false
+	}
+	if fix, err := time.Parse(time.RFC3339, fields[dongleConfig.TimeSync.GPSTimeField]); err == nil {
+		position.Time = fix
+	}
+	position.Valid = position.Latitude != 0 || position.Longitude != 0
+	return position, true
+}
+
+// readNMEA forwards sentences from an NMEA source until shutdown, reopening it
+// when it closes. Serial devices must already be configured, e.g. with stty.
+func readNMEA(path string) {
+	for {
+		file, err := os.Open(path)
+		if err != nil {
+			logger("gnss").Warnf("Failed to open %s: %v", path, err)
+		} else {
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if strings.HasPrefix(line, "$") {
+					gnssForwarder.AddSentence(line)
+				}
+			}
+			file.Close()
+			logger("gnss").Debugf("%s closed, reopening", path)
+		}
+
+		select {
+		case <-gnssStop:
+			return
+		case <-time.After(gnssReopenDelay):
+		}
+	}
+}
+
+// stopGNSS stops GNSS forwarding
+func stopGNSS() {
+	if gnssForwarder == nil {
+		return
+	}
+	close(gnssStop)
+	gnssForwarder.Stop()
+}
+
+// gnssStatus returns the forwarding state for the status endpoint
+func gnssStatus() interface{} {
+	if gnssForwarder == nil {
+		return nil
+	}
+	return gnssForwarder.GetInfo()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/mzyy94/gocarplay"
+	"github.com/mzyy94/gocarplay/link"
+	"github.com/mzyy94/gocarplay/metrics"
+)
+
+// inputAuditMax is the number of blocked events kept in the Redis audit list
+const inputAuditMax = 1000
+
+// inputRestrictionInterval rechecks the restriction while no speed arrives, so a stale speed is noticed
+const inputRestrictionInterval = time.Second
+
+var inputPolicy *link.InputPolicy
+
+// initInputPolicy restricts touch and key input above the configured speed,
+// reporting every blocked gesture and key press
+func initInputPolicy() {
+	config := dongleConfig.InputPolicy
+	if config.SpeedLimit > 0 && dongleConfig.Vehicle.Speed.Hash == "" && !config.AllowUnknown {
+		// Without a speed source the speed stays unknown and all input would be blocked
+		logger("input").Warn("No vehicle speed source configured, input is not restricted")
+		config.AllowUnknown = true
+	}
+
+	var err error
+	inputPolicy, err = link.NewInputPolicy(config, vehicleManager.GetState)
+	if err != nil {
+		// Fail safe: keep blocking above the speed limit with the defaults
+		logger("input").Warnf("%v, using default input policy", err)
+		inputPolicy, _ = link.NewInputPolicy(gocarplay.InputPolicyConfig{
+			SpeedLimit:   config.SpeedLimit,
+			SpeedMaxAge:  config.SpeedMaxAge,
+			AllowUnknown: config.AllowUnknown,
+		}, vehicleManager.GetState)
+	}
+	link.SetInputPolicy(inputPolicy)
+	metrics.NewCounterFunc("carplay_input_audit_dropped_total", "Blocked input events not delivered to the audit log.", func() uint64 {
+		return inputPolicy.GetStats().AuditDropped
+	})
+
+	go auditInput(inputPolicy.Subscribe())
+	go publishInputRestriction(vehicleManager.Subscribe())
+	logger("input").Infof("Input policy: %s above %.0f km/h", inputPolicy.Mode(), inputPolicy.SpeedLimit())
+}
+
+// auditInput logs blocked events and appends them to the Redis audit list
+func auditInput(events chan link.InputAudit) {
+	for event := range events {
+		inputBlocked.With(event.Reason).Inc()
+		if event.Speed < 0 {
+			logger("input").Warnf("Input %s %s at unknown speed", event.Input, event.Reason)
+		} else {
+			logger("input").Warnf("Input %s %s at %.1f km/h", event.Input, event.Reason, event.Speed)
+		}
+
+		if redis == nil || dongleConfig.InputPolicy.AuditList == "" {
+			continue
+		}
+		entry, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		redis.PushEvent(dongleConfig.InputPolicy.AuditList, string(entry), inputAuditMax)
+	}
+}
+
+// publishInputRestriction publishes whether input is restricted when the speed
+// changes or goes stale
+func publishInputRestriction(updates chan link.VehicleState) {
+	ticker := time.NewTicker(inputRestrictionInterval)
+	defer ticker.Stop()
+	last := ""
+
+	for {
+		select {
+		case _, ok := <-updates:
+			if !ok {
+				return
+			}
+		case <-ticker.C:
+		}
+
+		state := "enabled"
+		if inputPolicy.Restricted() {
+			state = "disabled"
+			if inputPolicy.Mode() == link.InputPolicyRateLimit {
+				state = "limited"
+			}
+		}
+		if state == last {
+			continue
+		}
+		last = state
+
+		logger("input").Infof("Touch input %s", state)
+		if redis != nil {
+			redis.PublishState("touch_input", state)
+		}
+	}
+}
+
+// inputPolicyHandler returns the input restrictions and recently blocked events
+func inputPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mode":        inputPolicy.Mode(),
+		"speed_limit": inputPolicy.SpeedLimit(),
+		"speed":       vehicleManager.Speed(),
+		"restricted":  inputPolicy.Restricted(),
+		"stats":       inputPolicy.GetStats(),
+		"blocked":     inputPolicy.GetRecent(),
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/mzyy94/gocarplay/link"
+	"github.com/mzyy94/gocarplay/logging"
+	redisClient "github.com/mzyy94/gocarplay/redis"
+)
+
+// logger returns the logger for a server component
+func logger(component string) *logging.Logger {
+	return logging.Default().Named(component)
+}
+
+// initLogging configures the root logger from the environment and injects it into
+// the link and redis packages. LOG_LEVEL sets the default level, LOG_LEVELS sets
+// per-component levels ("video=debug,redis=warn"), LOG_FORMAT selects text or json.
+// DEBUG=1 is kept as a shorthand for LOG_LEVEL=debug.
+func initLogging() {
+	root := logging.Default()
+
+	if os.Getenv("LOG_FORMAT") == string(logging.FormatJSON) {
+		root.SetFormat(logging.FormatJSON)
+	}
+	if os.Getenv("DEBUG") == "1" {
+		root.SetLevel("", logging.LevelDebug)
+	}
+	if env := os.Getenv("LOG_LEVEL"); env != "" {
+		if level, err := logging.ParseLevel(env); err == nil {
+			root.SetLevel("", level)
+		} else {
+			logger("server").Warnf("Ignoring LOG_LEVEL: %v", err)
+		}
+	}
+	for _, entry := range strings.Split(os.Getenv("LOG_LEVELS"), ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		level, err := logging.ParseLevel(parts[1])
+		if err != nil {
+			logger("server").Warnf("Ignoring LOG_LEVELS entry %s: %v", entry, err)
+			continue
+		}
+		root.SetLevel(parts[0], level)
+	}
+
+	link.SetLogger(root)
+	redisClient.SetLogger(root)
+}
+
+// loggingHandler returns the log levels, or changes the level of a component
+func loggingHandler(w http.ResponseWriter, r *http.Request) {
+	root := logging.Default()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Component string `json:"component"` // "" changes the default level
+			Level     string `json:"level"`     // "" resets the component to the default level
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+			return
+		}
+		if req.Level == "" && req.Component != "" {
+			root.ResetLevel(req.Component)
+		} else {
+			level, err := logging.ParseLevel(req.Level)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			root.SetLevel(req.Component, level)
+		}
+		logger("server").Infof("Log level changed: component=%q level=%q", req.Component, req.Level)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	defaultLevel, overrides := root.Levels()
+	levels := make(map[string]string)
+	for _, component := range root.Components() {
+		level := defaultLevel
+		if override, ok := overrides[component]; ok {
+			level = override
+		}
+		levels[component] = level.String()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"default":    defaultLevel.String(),
+		"components": levels,
+	})
+}
@@ -1,25 +1,20 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
-	"mime/multipart"
 	"net/http"
-	"net/textproto"
 	"os"
-	"os/exec"
-	"sync"
 	"time"
 
 	"github.com/mzyy94/gocarplay"
 	"github.com/mzyy94/gocarplay/link"
+	"github.com/mzyy94/gocarplay/logging"
+	"github.com/mzyy94/gocarplay/metrics"
 	"github.com/mzyy94/gocarplay/protocol"
 	redisClient "github.com/mzyy94/gocarplay/redis"
+	"github.com/mzyy94/gocarplay/store"
 )
 
 type deviceSize struct {
@@ -37,43 +32,30 @@ var (
 	size        deviceSize
 	fps         int32 = 30 // Output fps after ffmpeg conversion
 	dongleReady bool
-	debugMode   bool // Enable verbose debug logging via DEBUG=1 environment variable
 
 	// Connection state management
 	stateManager   *link.StateManager
 	hotplugManager *link.HotplugManager
+	watchdog       *link.Watchdog
+	sessionManager *link.SessionManager
+	dispatcher     *link.EventDispatcher
 
-	// MJPEG streaming
-	streamClients sync.Map // map of client channels
-	jpegFrames    chan []byte
-	h264Frames    chan []byte
-
-	// ffmpeg process
-	ffmpegCmd           *exec.Cmd
-	ffmpegStdin         io.WriteCloser
-	ffmpegStdout        io.ReadCloser
-	ffmpegStdoutBuffered *bufio.Reader // Buffered reader for efficient I/O
-	ffmpegMutex         sync.Mutex
-
-	// Debug counters
-	h264FrameCount int64
-	jpegFrameCount int64
-
-	// Frame size statistics for diagnostic purposes
-	h264TotalSize int64
-	jpegTotalSize int64
+	// H.264 to MJPEG pipelines of the main and navigation screens
+	mainVideo = newVideoPipeline("main", "")
+	naviVideo = newVideoPipeline("navi", "navi_")
 
 	// Redis client for state publishing
 	redis *redisClient.Client
+
+	// Dongle configuration (defaults overlaid with CONFIG_FILE and environment)
+	dongleConfig *gocarplay.DongleConfig
+
+	// Persistent service state
+	stateStore *store.Store
 )
 
-func init() {
-	// Minimal buffers for low latency
-	// 3 frames = ~100ms at 30fps
-	// Small buffers are critical to avoid lag - we want real-time streaming!
-	jpegFrames = make(chan []byte, 3)
-	h264Frames = make(chan []byte, 3)
-}
+// defaultConfigFile is used when CONFIG_FILE is not set
+const defaultConfigFile = "/etc/carplay-service/config.json"
 
 // mapDeviceType converts protocol.PhoneType to simple device type string
 func mapDeviceType(phoneType protocol.PhoneType) string {
@@ -92,215 +74,76 @@ func handleMediaData(data *protocol.MediaData) {
 	if data.Type == protocol.MediaTypeData {
 		var mediaInfo map[string]interface{}
 		if err := json.Unmarshal(data.MediaInfo, &mediaInfo); err == nil {
-			log.Printf("[Media Info] %v", mediaInfo)
+			logger("media").Infof("Media info: %v", mediaInfo)
 		}
 	} else if data.Type == protocol.MediaTypeAlbumCover {
-		log.Printf("[Album Cover] Received %d bytes of image data", len(data.MediaInfo))
+		logger("media").Infof("Album cover: %d bytes of image data", len(data.MediaInfo))
 	}
 }
 
-func startFFmpegConverter() error {
-	ffmpegMutex.Lock()
-	defer ffmpegMutex.Unlock()
-
-	// ffmpeg command: read H.264 from stdin, output JPEG frames to stdout
-	// -f h264 explicitly tells ffmpeg the input is raw H.264 Annex-B stream
-	ffmpegCmd = exec.Command("ffmpeg",
-		"-f", "h264",
-		"-threads", "4",
-		"-i", "pipe:0",
-		"-f", "image2pipe",
-		"-vcodec", "mjpeg",
-		"-q:v", "5",
-		"pipe:1",
-	)
-
-	var err error
-	ffmpegStdin, err = ffmpegCmd.StdinPipe()
-	if err != nil {
-		return fmt.Errorf("failed to get stdin pipe: %v", err)
-	}
-
-	ffmpegStdout, err = ffmpegCmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("failed to get stdout pipe: %v", err)
-	}
-
-	// Wrap stdout with a large buffered reader (256KB) for efficient I/O
-	// This reduces kernel overhead and improves streaming performance
-	ffmpegStdoutBuffered = bufio.NewReaderSize(ffmpegStdout, 256*1024)
-
-	// Capture stderr for debugging
-	stderrPipe, err := ffmpegCmd.StderrPipe()
-	if err != nil {
-		return fmt.Errorf("failed to get stderr pipe: %v", err)
-	}
+// loadConfig builds the dongle configuration from server defaults,
+// the optional JSON config file and the USB_DEVICES environment variable
+func loadConfig() *gocarplay.DongleConfig {
+	config := gocarplay.DefaultConfig()
+	config.Width = 800
+	config.Height = 480
+	config.Fps = 30
+	config.Dpi = 140
+	config.AudioTransferMode = false
 
-	if err := ffmpegCmd.Start(); err != nil {
-		return fmt.Errorf("failed to start ffmpeg: %v", err)
+	configFile := os.Getenv("CONFIG_FILE")
+	if configFile == "" {
+		configFile = defaultConfigFile
 	}
-
-	log.Println("[FFmpeg] Started converter process with 256KB buffered I/O")
-
-	// Log ffmpeg errors in background
-	go func() {
-		scanner := bufio.NewScanner(stderrPipe)
-		for scanner.Scan() {
-			line := scanner.Text()
-			// Only log important messages, skip verbose output
-			if len(line) > 0 && line[0] != ' ' {
-				log.Printf("[FFmpeg] %s", line)
-			}
+	if err := config.LoadFile(configFile); err != nil {
+		if os.IsNotExist(err) {
+			logger("link").Infof("No config file at %s, using defaults", configFile)
+		} else {
+			logger("link").Warnf("%v (using defaults)", err)
 		}
-	}()
-
-	// Start H.264 writer goroutine
-	go writeH264ToFFmpeg()
-
-	// Start JPEG reader goroutine
-	go readJPEGFromFFmpeg()
-
-	return nil
-}
-
-func writeH264ToFFmpeg() {
-	for frame := range h264Frames {
-		// Get pipe reference with mutex, but don't hold it during blocking write
-		// This prevents deadlock when ffmpeg blocks on stdin
-		ffmpegMutex.Lock()
-		stdin := ffmpegStdin
-		ffmpegMutex.Unlock()
-
-		if stdin != nil {
-			if _, err := stdin.Write(frame); err != nil {
-				log.Printf("[FFmpeg] Error writing H.264 frame: %v", err)
-				continue
-			}
+	} else {
+		logger("link").Infof("Loaded %s", configFile)
+		if config.Vehicle.TouchSpeedLimit != nil {
+			logger("link").Warnf("vehicle.touchSpeedLimit is deprecated, use inputPolicy.speedLimit (now %.0f km/h)", config.InputPolicy.SpeedLimit)
 		}
 	}
-}
 
-func readJPEGFromFFmpeg() {
-	for {
-		// Read JPEG frame from buffered ffmpeg stdout
-		// JPEG format: starts with FF D8, ends with FF D9
-		jpeg, err := readJPEGFrame(ffmpegStdoutBuffered)
+	if env := os.Getenv("USB_DEVICES"); env != "" {
+		devices, err := gocarplay.ParseUSBDevices(env)
 		if err != nil {
-			log.Printf("[FFmpeg] Error reading JPEG frame: %v", err)
-			time.Sleep(100 * time.Millisecond)
-			continue
-		}
-
-		jpegFrameCount++
-
-		// Validate JPEG frame markers
-		if jpegFrameCount <= 5 || jpegFrameCount%100 == 0 {
-			hasValidStart := len(jpeg) >= 2 && jpeg[0] == 0xFF && jpeg[1] == 0xD8
-			hasValidEnd := len(jpeg) >= 2 && jpeg[len(jpeg)-2] == 0xFF && jpeg[len(jpeg)-1] == 0xD9
-			log.Printf("[JPEG] Frame #%d: size=%d, validStart=%v, validEnd=%v, first4bytes=[%02X %02X %02X %02X]",
-				jpegFrameCount, len(jpeg), hasValidStart, hasValidEnd,
-				jpeg[0], jpeg[1], jpeg[2], jpeg[3])
-		}
-
-		if debugMode && jpegFrameCount%500 == 1 {
-			log.Printf("[FFmpeg] Converted JPEG frame #%d, size: %d bytes", jpegFrameCount, len(jpeg))
-		}
-
-		// CRITICAL: Drain old JPEG frames to prioritize the latest
-		drained := 0
-		drainJpegLoop:
-			for {
-				select {
-				case <-jpegFrames:
-					drained++
-				default:
-					break drainJpegLoop
-				}
-			}
-
-		if drained > 0 && debugMode {
-			log.Printf("[FFmpeg] Drained %d old JPEG frames to prioritize latest", drained)
-		}
-
-		// Send to broadcast channel (non-blocking)
-		select {
-		case jpegFrames <- jpeg:
-		default:
-			// Drop frame if buffer is full (only log in debug mode)
-			if debugMode {
-				log.Printf("[FFmpeg] WARNING: Dropped JPEG frame, channel full after drain")
-			}
+			logger("link").Warnf("Ignoring USB_DEVICES: %v", err)
+		} else {
+			config.USBDevices = append(config.USBDevices, devices...)
 		}
 	}
-}
-
-func readJPEGFrame(reader io.Reader) ([]byte, error) {
-	// SIMPLE BYTE-BY-BYTE READING - most reliable approach
-	// Testing version to isolate if buffered reading was causing issues
 
-	var buf bytes.Buffer
-	b := make([]byte, 1)
+	return config
+}
 
-	// Find JPEG start marker (FF D8)
-	for {
-		if _, err := reader.Read(b); err != nil {
-			return nil, err
+// publishDongleEvents publishes typed dongle events to Redis
+func publishDongleEvents(events chan link.Event) {
+	for event := range events {
+		logger("events").Infof("%s: %+v", event.Name(), event)
+		if redis == nil {
+			continue
 		}
-		if b[0] == 0xFF {
-			if _, err := reader.Read(b); err != nil {
-				return nil, err
-			}
-			if b[0] == 0xD8 {
-				// Found start marker
-				buf.Write([]byte{0xFF, 0xD8})
-				break
+		switch event := event.(type) {
+		case link.BluetoothEvent:
+			redis.PublishState("bluetooth_connected", fmt.Sprintf("%v", event.Connected))
+		case link.WifiEvent:
+			redis.PublishState("wifi_connected", fmt.Sprintf("%v", event.Connected))
+		case link.DeviceSearchEvent:
+			redis.PublishState("device_search", event.Status.String())
+		case link.HostUIRequestEvent:
+			redis.PublishState("ui_request", "host")
+		case link.MicrophoneEvent:
+			if event.Recording {
+				redis.PublishState("microphone", "recording")
+			} else {
+				redis.PublishState("microphone", "idle")
 			}
 		}
 	}
-
-	// Read until we find end marker (FF D9)
-	prevByte := byte(0)
-	for {
-		if _, err := reader.Read(b); err != nil {
-			return nil, err
-		}
-		buf.WriteByte(b[0])
-
-		if prevByte == 0xFF && b[0] == 0xD9 {
-			// Found end marker, JPEG is complete
-			return buf.Bytes(), nil
-		}
-		prevByte = b[0]
-	}
-}
-
-// Broadcast JPEG frames to all connected clients
-func broadcastFrames() {
-	for frame := range jpegFrames {
-		streamClients.Range(func(key, value interface{}) bool {
-			clientChan := value.(chan []byte)
-
-			// Drain old frames from this client's channel to prioritize latest
-			drained := 0
-		drainClientLoop:
-			for {
-				select {
-				case <-clientChan:
-					drained++
-				default:
-					break drainClientLoop
-				}
-			}
-
-			// Now send the latest frame (non-blocking)
-			select {
-			case clientChan <- frame:
-			default:
-				// Skip if client is still slow after draining
-			}
-			return true
-		})
-	}
 }
 
 func streamHandler(w http.ResponseWriter, r *http.Request) {
@@ -308,75 +151,20 @@ func streamHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Dongle not ready", http.StatusServiceUnavailable)
 		return
 	}
+	mainVideo.serveMJPEG(w, r)
+}
 
-	// Set headers for MJPEG streaming
-	boundary := "frame"
-	w.Header().Set("Content-Type", fmt.Sprintf("multipart/x-mixed-replace; boundary=%s", boundary))
-	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+// naviStreamHandler streams the navigation screen, if requested from the dongle
+func naviStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if !dongleConfig.NaviScreen.Enabled {
+		http.Error(w, "Navigation screen not enabled", http.StatusNotFound)
 		return
 	}
-
-	clientID := fmt.Sprintf("%p", r)
-	log.Printf("[Stream] New MJPEG client connected: %s", clientID)
-
-	// Create channel for this client with minimal buffer for low latency
-	// 2 frames = ~66ms at 30fps
-	clientChan := make(chan []byte, 2)
-	streamClients.Store(clientID, clientChan)
-
-	// Clean up on disconnect
-	defer func() {
-		streamClients.Delete(clientID)
-		close(clientChan)
-		log.Printf("[Stream] Client disconnected: %s", clientID)
-	}()
-
-	// Create multipart writer
-	mw := multipart.NewWriter(w)
-	mw.SetBoundary(boundary)
-
-	// Stream JPEG frames to client
-	framesSent := int64(0)
-	for {
-		select {
-		case frame := <-clientChan:
-			framesSent++
-
-			// Log first 5 frames and every 100th frame
-			if framesSent <= 5 || framesSent%100 == 0 {
-				log.Printf("[Stream] Sending frame #%d to client %s: size=%d bytes",
-					framesSent, clientID, len(frame))
-			}
-
-			// Create part header
-			partHeader := make(textproto.MIMEHeader)
-			partHeader.Add("Content-Type", "image/jpeg")
-			partHeader.Add("Content-Length", fmt.Sprintf("%d", len(frame)))
-
-			part, err := mw.CreatePart(partHeader)
-			if err != nil {
-				log.Printf("[Stream] Error creating part: %v", err)
-				return
-			}
-
-			// Write JPEG data
-			if _, err := part.Write(frame); err != nil {
-				log.Printf("[Stream] Error writing frame: %v", err)
-				return
-			}
-
-			flusher.Flush()
-
-		case <-r.Context().Done():
-			return
-		}
+	if !dongleReady {
+		http.Error(w, "Dongle not ready", http.StatusServiceUnavailable)
+		return
 	}
+	naviVideo.serveMJPEG(w, r)
 }
 
 func touchHandler(w http.ResponseWriter, r *http.Request) {
@@ -405,8 +193,15 @@ func touchHandler(w http.ResponseWriter, r *http.Request) {
 		Y:      y,
 		Action: protocol.TouchAction(touch.Action),
 	}); err != nil {
-		log.Printf("[Touch] Error sending touch event: %v", err)
-		http.Error(w, "Failed to send touch event", http.StatusInternalServerError)
+		switch err {
+		case link.ErrInputBlocked:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case link.ErrInputRateLimited:
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+		default:
+			logger("touch").Errorf("Error sending touch event: %v", err)
+			http.Error(w, "Failed to send touch event", http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -417,11 +212,7 @@ func touchHandler(w http.ResponseWriter, r *http.Request) {
 func statusHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	var clientCount int
-	streamClients.Range(func(key, value interface{}) bool {
-		clientCount++
-		return true
-	})
+	clientCount := mainVideo.clientCount()
 
 	var connectionState string
 	if stateManager != nil {
@@ -430,11 +221,22 @@ func statusHandler(w http.ResponseWriter, r *http.Request) {
 		connectionState = "unknown"
 	}
 
+	session := sessionManager.GetInfo()
+
 	if dongleReady {
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status":           "ready",
 			"dongle_state":     connectionState,
+			"session_state":    session.State.String(),
+			"phase":            session.Phase.String(),
+			"wireless":         wirelessStatus(),
+			"dongle":           link.GetDongleInfo(),
+			"box_settings":     link.GetBoxSettingsInfo(),
+			"call_state":       callManager.GetState().String(),
+			"gnss":             gnssStatus(),
+			"vehicle":          vehicleManager.GetState(),
+			"navi_screen":      naviScreenStatus(),
 			"width":            size.Width,
 			"height":           size.Height,
 			"fps":              fps,
@@ -447,39 +249,32 @@ func statusHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status":          "dongle_not_connected",
 			"dongle_state":    connectionState,
+			"session_state":   session.State.String(),
+			"wireless":        wirelessStatus(),
 			"hotplug_enabled": true,
 			"message":         "Waiting for USB dongle attachment",
 		})
 	}
 }
 
-func stopVideoPipeline() {
-	log.Println("[Pipeline] Stopping video pipeline...")
-
-	ffmpegMutex.Lock()
-	defer ffmpegMutex.Unlock()
-
-	if ffmpegStdin != nil {
-		ffmpegStdin.Close()
-		ffmpegStdin = nil
-	}
-	if ffmpegCmd != nil && ffmpegCmd.Process != nil {
-		ffmpegCmd.Process.Kill()
-		ffmpegCmd.Wait()
-		ffmpegCmd = nil
+// naviScreenStatus returns the navigation screen for the status endpoint
+func naviScreenStatus() map[string]interface{} {
+	navi := dongleConfig.NaviScreen
+	return map[string]interface{}{
+		"enabled": navi.Enabled,
+		"width":   navi.Width,
+		"height":  navi.Height,
+		"fps":     navi.Fps,
+		"clients": naviVideo.clientCount(),
 	}
-
-	ffmpegStdout = nil
-	ffmpegStdoutBuffered = nil
-
-	log.Println("[Pipeline] Video pipeline stopped")
 }
 
 func handleConnection() error {
-	log.Println("[Hotplug] Handling dongle connection...")
+	logger("hotplug").Info("Handling dongle connection...")
 
-	size.Width = 800
-	size.Height = 480
+	config := *dongleConfig
+	size.Width = config.Width
+	size.Height = config.Height
 
 	// Connect to dongle
 	epIn, epOut, cleanup, err := link.ConnectOnce()
@@ -492,98 +287,74 @@ func handleConnection() error {
 		cleanup()
 		return fmt.Errorf("failed to initialize link: %v", err)
 	}
+	sessionManager.DongleAttached()
 
-	config := gocarplay.DefaultConfig()
-	config.Width = 800
-	config.Height = 480
-	config.Fps = 30
-	config.Dpi = 140
-	config.AudioTransferMode = false
-
-	log.Println("[Hotplug] Starting communication with dongle...")
+	logger("hotplug").Info("Starting communication with dongle...")
 	go func() {
 		err := link.Communicate(func(data interface{}) {
+			sessionManager.HandleMessage(data)
+
 			switch data := data.(type) {
 			case *protocol.VideoData:
 				// Send H.264 frame to converter
-				h264FrameCount++
-
-				// Warn about suspiciously small H.264 frames
-				if len(data.Data) > 0 && len(data.Data) < 100 && h264FrameCount > 10 {
-					if h264FrameCount%100 == 0 {
-						log.Printf("[Video] WARNING: Frame #%d is very small (%d bytes)", h264FrameCount, len(data.Data))
-					}
-				}
-
-				// Diagnostic for first 10 frames
-				if h264FrameCount <= 10 && len(data.Data) >= 5 {
-					nalType := "unknown"
-					if len(data.Data) >= 5 && data.Data[0] == 0 && data.Data[1] == 0 {
-						nalUnitType := data.Data[4] & 0x1F
-						switch nalUnitType {
-						case 1:
-							nalType = "P-frame"
-						case 5:
-							nalType = "I-frame"
-						case 7:
-							nalType = "SPS"
-						case 8:
-							nalType = "PPS"
-						}
-					}
-					log.Printf("[Video] Frame #%d: NAL=%s, Size=%d", h264FrameCount, nalType, len(data.Data))
-				}
-
-				// Only send non-empty frames
-				if len(data.Data) > 0 {
-					// Drain old frames
-					drained := 0
-					for {
-						select {
-						case <-h264Frames:
-							drained++
-						default:
-							goto done
-						}
-					}
-				done:
-					// Send latest frame
-					select {
-					case h264Frames <- data.Data:
-					default:
-						if debugMode {
-							log.Printf("[Video] Dropped H.264 frame")
-						}
-					}
+				videoFrames.Inc()
+				videoBytes.Add(uint64(len(data.Data)))
+				mainVideo.push(data.Data)
+			case *protocol.NaviVideoData:
+				naviVideo.push(data.Data)
+			case *protocol.NaviFocusRequest, *protocol.NaviFocusRelease:
+				_, focused := data.(*protocol.NaviFocusRequest)
+				logger("video").Infof("Navigation focus: %v", focused)
+				if redis != nil {
+					redis.PublishState("navi_focus", fmt.Sprintf("%v", focused))
 				}
 			case *protocol.Plugged:
-				log.Printf("[Device Plugged] PhoneType: %v, WiFi: %v", data.PhoneType, data.Wifi)
+				logger("link").Infof("Phone plugged: type %v, WiFi: %v", data.PhoneType, data.Wifi)
 				link.HandlePhonePlugged(data)
 				if redis != nil {
 					redis.PublishState("device_connected", "true")
 					redis.PublishState("device_type", mapDeviceType(data.PhoneType))
 				}
 			case *protocol.Unplugged:
-				log.Println("[Device Unplugged]")
+				logger("link").Info("Phone unplugged")
+				link.ClearPhoneInfo()
+				wirelessManager.HandleMessage(data)
+				callManager.Reset()
+				assistantManager.Reset()
+				publishBoxSettings()
 				if redis != nil {
 					redis.PublishState("device_connected", "false")
 					redis.PublishState("device_type", "none")
 				}
 			case *protocol.Phase:
-				log.Printf("[Phase] %v", data.PhaseValue)
+				logger("link").Infof("Phase: %v (%d)", data.PhaseValue, uint32(data.PhaseValue))
 			case *protocol.BoxSettings:
-				log.Printf("[BoxSettings] %s", string(data.Settings))
+				link.HandleBoxSettings(data)
+				wirelessManager.HandleMessage(data)
+				publishBoxSettings()
+			case *protocol.BluetoothAddress, *protocol.BluetoothDeviceName, *protocol.BluetoothPIN, *protocol.BluetoothPairedList:
+				bluetoothManager.HandleMessage(data)
+			case *protocol.WifiDeviceName:
+				wirelessManager.HandleMessage(data)
+			case *protocol.SoftwareVersion, *protocol.ManufacturerInfo:
+				link.HandleDongleInfo(data)
+				publishFirmware()
+			case *protocol.CarPlay:
+				if !dispatcher.Dispatch(data) {
+					logger("link").Warnf("Unhandled command: %#v", data.Type)
+				}
 			case *protocol.MediaData:
 				handleMediaData(data)
 			case *protocol.AudioData:
-				if debugMode {
-					log.Printf("[Audio] Received %d bytes", len(data.Data))
+				if !callManager.HandleMessage(data) {
+					assistantManager.HandleMessage(data)
 				}
+				logger("audio").Debugf("Received %d bytes", len(data.Data))
 			default:
-				log.Printf("[onData] %#v", data)
+				logger("link").Infof("Unhandled message: %#v", data)
 			}
 		}, func(err error) {
-			log.Printf("[ERROR] %#v", err)
+			logger("link").Errorf("%v", err)
 			if redis != nil {
 				redis.PublishState("error", fmt.Sprintf("%v", err))
 			}
@@ -591,24 +362,44 @@ func handleConnection() error {
 
 		// Communication loop ended
 		if err != nil && err != context.Canceled {
-			log.Printf("[Comm] Communication loop ended with error: %v", err)
+			logger("link").Warnf("Communication loop ended with error: %v", err)
 		}
 	}()
 
-	go link.StartWithConfig(config)
+	go func() {
+		if err := link.StartWithConfig(&config); err != nil {
+			logger("link").Errorf("Failed to configure dongle: %v", err)
+			return
+		}
+		sessionManager.MarkConfigured()
+		if err := phoneSelector.Apply(); err != nil && err != link.ErrPairedListWriteDisabled {
+			logger("autoconnect").Errorf("Failed to apply policy: %v", err)
+		}
+		if err := assistantManager.Configure(); err != nil {
+			logger("assistant").Errorf("Failed to send assistant logo: %v", err)
+		}
+		wirelessManager.Begin()
+	}()
 
-	// Start video pipeline
-	if err := startFFmpegConverter(); err != nil {
+	// Start video pipelines
+	if err := mainVideo.start(); err != nil {
 		return fmt.Errorf("failed to start ffmpeg: %v", err)
 	}
-
-	// Start frame broadcaster
-	go broadcastFrames()
+	if config.NaviScreen.Enabled {
+		// The navigation screen is optional, carry on with the main screen only
+		if err := naviVideo.start(); err != nil {
+			logger("video").Errorf("Failed to start navigation ffmpeg, navigation stream unavailable: %v", err)
+		}
+	}
 
 	time.Sleep(200 * time.Millisecond)
 
 	dongleReady = true
-	log.Println("[Hotplug] Dongle fully initialized and ready")
+	logger("hotplug").Info("Dongle fully initialized and ready")
+	if connectedOnce {
+		reconnects.Inc()
+	}
+	connectedOnce = true
 
 	// Publish state to Redis
 	if redis != nil {
@@ -620,29 +411,23 @@ func handleConnection() error {
 }
 
 func handleDisconnection() {
-	log.Println("[Hotplug] Handling dongle disconnection...")
+	logger("hotplug").Info("Handling dongle disconnection...")
 
 	dongleReady = false
+	sessionManager.DongleDetached()
+	bluetoothManager.Reset()
+	wirelessManager.Stop()
+	callManager.Reset()
+	assistantManager.Reset()
 
 	// Close link connection (this cancels the communication loop internally)
 	link.Close()
 
-	// Stop video pipeline
-	stopVideoPipeline()
+	// Stop video pipelines
+	mainVideo.stop()
+	naviVideo.stop()
 
-	// Drain channels
-	for len(h264Frames) > 0 {
-		<-h264Frames
-	}
-	for len(jpegFrames) > 0 {
-		<-jpegFrames
-	}
-
-	// Reset counters
-	h264FrameCount = 0
-	jpegFrameCount = 0
-
-	log.Println("[Hotplug] Disconnection cleanup complete")
+	logger("hotplug").Info("Disconnection cleanup complete")
 
 	// Publish state to Redis
 	if redis != nil {
@@ -653,7 +438,25 @@ func handleDisconnection() {
 }
 
 func cleanup() {
-	log.Println("Shutting down...")
+	logger("server").Info("Shutting down...")
+
+	// Stop liveness monitoring
+	if watchdog != nil {
+		watchdog.Stop()
+	}
+
+	// Stop dongle clock sync
+	if timeSync != nil {
+		timeSync.Stop()
+	}
+
+	// Stop GNSS forwarding
+	stopGNSS()
+
+	// Stop vehicle info forwarding
+	if vehicleManager != nil {
+		vehicleManager.Stop()
+	}
 
 	// Stop hotplug monitoring
 	if hotplugManager != nil {
@@ -670,17 +473,24 @@ func cleanup() {
 }
 
 func main() {
-	// Check for debug mode
-	debugMode = os.Getenv("DEBUG") == "1"
-
-	log.Println("GoCarPlay Server starting (daemon mode with hotplug support)...")
-	log.Println("Configured resolution: 800x480 @ 30fps")
-	log.Println("Streaming: MJPEG over HTTP (H.264 -> JPEG conversion via ffmpeg)")
-	if debugMode {
-		log.Println("Debug mode: ENABLED (set DEBUG=0 to disable)")
-	} else {
-		log.Println("Debug mode: DISABLED (set DEBUG=1 to enable)")
+	// Configure logging first so every component logs with the configured levels
+	initLogging()
+
+	logger("server").Info("GoCarPlay Server starting (daemon mode with hotplug support)...")
+
+	dongleConfig = loadConfig()
+	link.RegisterDevices(dongleConfig.USBDevices)
+	link.AddCompatibilityRules(dongleConfig.Compatibility)
+
+	var err error
+	stateStore, err = store.Open(dongleConfig.StateFile)
+	if err != nil {
+		logger("server").Warnf("Failed to open state file: %v (state will not persist)", err)
 	}
+	logger("server").Infof("Configured resolution: %dx%d @ %dfps", dongleConfig.Width, dongleConfig.Height, dongleConfig.Fps)
+	logger("server").Info("Streaming: MJPEG over HTTP (H.264 -> JPEG conversion via ffmpeg)")
+	defaultLevel, _ := logging.Default().Levels()
+	logger("server").Infof("Log level: %v (set LOG_LEVEL or DEBUG=1 to change)", defaultLevel)
 
 	// Initialize Redis client
 	redisAddr := os.Getenv("REDIS_ADDR")
@@ -688,18 +498,80 @@ func main() {
 		redisAddr = "192.168.7.1:6379"
 	}
 	redis = redisClient.NewClient(redisAddr)
-	log.Printf("Redis client initialized (address: %s)", redisAddr)
+	logger("server").Infof("Redis client initialized (address: %s)", redisAddr)
 
 	// Test Redis connection (non-fatal if it fails)
 	if err := redis.Ping(); err != nil {
-		log.Printf("Warning: Redis connection failed: %v (continuing without Redis)", err)
+		logger("server").Warnf("Redis connection failed: %v (continuing without Redis)", err)
 	} else {
-		log.Println("Redis connection successful")
+		logger("server").Info("Redis connection successful")
 	}
 
+	// Collect metrics for /metrics
+	initMetrics()
+
+	// Protocol tracer for /debug/trace
+	initTrace()
+
 	// Initialize state manager
 	stateManager = link.NewStateManager()
-	log.Println("State manager initialized")
+	logger("server").Info("State manager initialized")
+
+	// Initialize phone session tracking and publish session changes
+	sessionManager = link.NewSessionManager()
+	go func() {
+		for session := range sessionManager.Subscribe() {
+			if redis == nil {
+				continue
+			}
+			redis.PublishState("session_state", session.State.String())
+			redis.PublishState("phase", session.Phase.String())
+			if session.State == link.SessionPhonePlugged {
+				if session.Wireless {
+					redis.PublishState("device_link", "wireless")
+				} else {
+					redis.PublishState("device_link", "wired")
+				}
+			}
+		}
+	}()
+
+	// Route dongle-originated commands to typed events
+	dispatcher = link.NewEventDispatcher()
+	go publishDongleEvents(dispatcher.Subscribe())
+
+	// Bluetooth pairing and paired-device management
+	initBluetooth()
+
+	// Wireless session management with retries
+	initWireless()
+
+	// Preferred-phone selection and auto-connect policy
+	initPhoneSelector()
+
+	// Allow-listed dongle file writes, re-applied after reconnects
+	initFiles()
+
+	// Phone call state and call control
+	initCalls()
+
+	// Voice assistant button and microphone uplink
+	initAssistant()
+
+	// Keep the dongle clock in sync
+	initTimeSync()
+
+	// Forward vehicle GNSS data to the phone
+	initGNSS()
+
+	// Vehicle telemetry forwarded to the phone
+	initVehicle()
+
+	// Speed-based touch and key input restrictions
+	initInputPolicy()
+
+	// Accept commands pushed to the Redis command list
+	redis.ListenCommands(handleCommand)
 
 	// Initialize hotplug manager
 	hotplugManager = link.NewHotplugManager(stateManager)
@@ -716,21 +588,44 @@ func main() {
 
 	// Start hotplug monitoring
 	if err := hotplugManager.Start(); err != nil {
-		log.Fatalf("Failed to start hotplug monitoring: %v", err)
+		logger("server").Fatalf("Failed to start hotplug monitoring: %v", err)
 	}
-	log.Println("Hotplug monitoring started")
+	logger("server").Info("Hotplug monitoring started")
+
+	// Publish connection state changes
+	go func() {
+		for state := range stateManager.Subscribe() {
+			if redis != nil {
+				redis.PublishState("dongle_state", state.String())
+			}
+		}
+	}()
+
+	// Initialize liveness watchdog for dongles that stay enumerated but stop responding
+	watchdog = link.NewWatchdog(stateManager)
+	watchdog.SetTimeout(time.Duration(dongleConfig.LivenessTimeout) * time.Millisecond)
+	watchdog.SetIdleTimeout(time.Duration(dongleConfig.IdleLivenessTimeout) * time.Millisecond)
+	watchdog.SetCallbacks(hotplugManager.Reconnect, func(step link.RecoveryStep) {
+		if step != link.RecoveryNone {
+			recoveries.With(step.String()).Inc()
+		}
+		if redis != nil {
+			redis.PublishState("recovery", step.String())
+		}
+	})
+	watchdog.Start()
 
 	// Attempt initial connection
-	log.Println("Attempting initial connection to dongle...")
+	logger("server").Info("Attempting initial connection to dongle...")
 	hotplugManager.TriggerConnectionAttempt()
 
 	// Give initial connection a moment to complete
 	time.Sleep(3 * time.Second)
 
 	if dongleReady {
-		log.Println("Initial connection successful!")
+		logger("server").Info("Initial connection successful!")
 	} else {
-		log.Println("No dongle detected at startup - waiting for hotplug event...")
+		logger("server").Info("No dongle detected at startup - waiting for hotplug event...")
 		if redis != nil {
 			redis.PublishState("dongle_available", "false")
 			redis.PublishState("error", "Waiting for dongle attachment")
@@ -740,16 +635,50 @@ func main() {
 	// Setup HTTP endpoints
 	http.HandleFunc("/touch", touchHandler)
 	http.HandleFunc("/stream", streamHandler)
+	http.HandleFunc("/stream/navi", naviStreamHandler)
 	http.HandleFunc("/status", statusHandler)
-
-	log.Println("Server ready on http://localhost:8001")
-	log.Println("Endpoints:")
-	log.Println("  POST /touch  - Touch input endpoint")
-	log.Println("  GET  /stream - MJPEG video stream")
-	log.Println("  GET  /status - Health check endpoint")
+	http.HandleFunc("/bluetooth", bluetoothHandler)
+	http.HandleFunc("/bluetooth/pair", bluetoothPairHandler)
+	http.HandleFunc("/bluetooth/forget", bluetoothForgetHandler)
+	http.HandleFunc("/phones/policy", phonePolicyHandler)
+	http.HandleFunc("/phones/select", phoneSelectHandler)
+	http.HandleFunc("/dongle/files", filesHandler)
+	http.HandleFunc("/call", callHandler)
+	http.HandleFunc("/call/accept", callActionHandler("accept call", callManager.Accept))
+	http.HandleFunc("/call/reject", callActionHandler("reject call", callManager.Reject))
+	http.HandleFunc("/call/hangup", callActionHandler("hang up", callManager.HangUp))
+	http.HandleFunc("/assistant", assistantHandler)
+	http.Handle("/metrics", metrics.Handler())
+	http.HandleFunc("/logging", loggingHandler)
+	http.HandleFunc("/input/policy", inputPolicyHandler)
+	http.HandleFunc("/debug/trace", traceHandler)
+	http.HandleFunc("/debug/trace/stream", traceStreamHandler)
+
+	logger("server").Info("Server ready on http://localhost:8001")
+	logger("server").Info("Endpoints:")
+	logger("server").Info("  POST /touch  - Touch input endpoint")
+	logger("server").Info("  GET  /stream - MJPEG video stream")
+	logger("server").Info("  GET  /stream/navi - MJPEG navigation screen stream (naviScreen.enabled)")
+	logger("server").Info("  GET  /status - Health check endpoint")
+	logger("server").Info("  GET  /bluetooth        - Bluetooth address, name, PIN and paired phones")
+	logger("server").Info("  POST /bluetooth/pair   - Start Bluetooth pairing mode")
+	logger("server").Info("  POST /bluetooth/forget - Forget a paired phone (needs pairedListReorder)")
+	logger("server").Info("  GET  /phones/policy    - Auto-connect policy (POST to change)")
+	logger("server").Info("  POST /phones/select    - Connect to a paired phone")
+	logger("server").Info("  GET  /dongle/files     - Files written to the dongle (POST to write one)")
+	logger("server").Info("  GET  /call             - Phone call state")
+	logger("server").Info("  POST /call/accept      - Accept the incoming call")
+	logger("server").Info("  POST /call/reject      - Reject the incoming call")
+	logger("server").Info("  POST /call/hangup      - End the active call")
+	logger("server").Info("  GET  /assistant        - Voice assistant state (POST to tap/press/release)")
+	logger("server").Info("  GET  /metrics          - Prometheus metrics")
+	logger("server").Info("  GET  /logging          - Log levels (POST to change a component's level)")
+	logger("server").Info("  GET  /input/policy     - Input restrictions while moving and blocked events")
+	logger("server").Info("  GET  /debug/trace      - Recorded protocol messages (POST to enable/disable/clear)")
+	logger("server").Info("  GET  /debug/trace/stream - Live protocol messages (Server-Sent Events)")
 
 	// Cleanup on exit
 	defer cleanup()
 
-	log.Fatal(http.ListenAndServe(":8001", nil))
+	logger("server").Fatalf("HTTP server failed: %v", http.ListenAndServe(":8001", nil))
 }
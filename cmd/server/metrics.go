@@ -0,0 +1,63 @@
+package main
+
+import (
+	"time"
+
+	"github.com/mzyy94/gocarplay/link"
+	"github.com/mzyy94/gocarplay/metrics"
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// videoRateInterval is the window over which video FPS and bitrate are measured
+const videoRateInterval = 5 * time.Second
+
+var (
+	messagesReceived    = metrics.NewCounterVec("carplay_messages_received_total", "Messages received from the dongle by type.", "type")
+	messagesSent        = metrics.NewCounterVec("carplay_messages_sent_total", "Messages sent to the dongle by type.", "type")
+	videoFrames         = metrics.NewCounter("carplay_video_frames_total", "H.264 frames received from the dongle.")
+	videoBytes          = metrics.NewCounter("carplay_video_bytes_total", "H.264 bytes received from the dongle.")
+	videoFPS            = metrics.NewGauge("carplay_video_fps", "H.264 frames per second received from the dongle.")
+	videoBitrate        = metrics.NewGauge("carplay_video_bitrate_bps", "H.264 bitrate received from the dongle in bits per second.")
+	droppedFrames       = metrics.NewCounterVec("carplay_dropped_frames_total", "Frames dropped or replaced by newer ones, by pipeline stage.", "channel")
+	clientDroppedFrames = metrics.NewCounterVec("carplay_stream_client_dropped_frames_total", "JPEG frames dropped per connected MJPEG client.", "client")
+	reconnects          = metrics.NewCounter("carplay_reconnects_total", "Dongle connections after the first one.")
+	recoveries          = metrics.NewCounterVec("carplay_recoveries_total", "Watchdog recovery steps taken.", "step")
+	transcoderRestarts  = metrics.NewCounter("carplay_transcoder_restarts_total", "ffmpeg transcoder restarts after it exited during a session.")
+	inputBlocked        = metrics.NewCounterVec("carplay_input_blocked_total", "Touch gestures and key presses blocked while moving, by reason.", "reason")
+)
+
+// connectedOnce tells the first connection from reconnects
+var connectedOnce bool
+
+// initMetrics registers collected metrics and starts sampling the video rate
+func initMetrics() {
+	metrics.NewGaugeFunc("carplay_mjpeg_clients", "Connected MJPEG stream clients.", func() float64 {
+		return float64(mainVideo.clientCount())
+	})
+	metrics.NewGaugeFunc("carplay_navi_mjpeg_clients", "Connected navigation screen MJPEG stream clients.", func() float64 {
+		return float64(naviVideo.clientCount())
+	})
+	metrics.NewCounterFunc("carplay_redis_publish_failures_total", "State changes that could not be published to Redis.", redis.PublishFailures)
+
+	link.AddMessageObserver(func(direction link.Direction, header protocol.Header, payload []byte, msg interface{}) {
+		if direction == link.DirectionSent {
+			messagesSent.With(protocol.MessageName(msg)).Inc()
+		} else {
+			messagesReceived.With(protocol.MessageName(msg)).Inc()
+		}
+	})
+
+	go func() {
+		ticker := time.NewTicker(videoRateInterval)
+		defer ticker.Stop()
+
+		lastFrames, lastBytes := videoFrames.Value(), videoBytes.Value()
+		for range ticker.C {
+			frames, bytes := videoFrames.Value(), videoBytes.Value()
+			seconds := videoRateInterval.Seconds()
+			videoFPS.Set(float64(frames-lastFrames) / seconds)
+			videoBitrate.Set(float64(bytes-lastBytes) * 8 / seconds)
+			lastFrames, lastBytes = frames, bytes
+		}
+	}()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mzyy94/gocarplay/link"
+)
+
+var phoneSelector *link.PhoneSelector
+
+// initPhoneSelector sets up the persisted auto-connect policy
+func initPhoneSelector() {
+	phoneSelector = link.NewPhoneSelector(dongleConfig.AutoConnect, bluetoothManager, stateStore)
+	wirelessManager.SetPhoneSelector(phoneSelector)
+	go publishPhoneSelection(phoneSelector.Subscribe())
+
+	registerCommand("phone-policy", func(args []string) error {
+		if len(args) < 1 {
+			return errors.New("usage: phone-policy <priority|last_used|ask> [address...]")
+		}
+		policy, err := link.ParseAutoConnectPolicy(args[0])
+		if err != nil {
+			return err
+		}
+		var priority []string
+		if len(args) > 1 {
+			priority = args[1:]
+		}
+		return phoneSelector.SetPolicy(policy, priority)
+	})
+	registerCommand("phone-select", func(args []string) error {
+		if len(args) != 1 {
+			return errors.New("usage: phone-select <address>")
+		}
+		return phoneSelector.Select(args[0])
+	})
+}
+
+// publishPhoneSelection publishes the auto-connect policy state to Redis
+func publishPhoneSelection(updates chan link.PhoneSelection) {
+	var last link.PhoneSelection
+	first := true
+
+	for selection := range updates {
+		if redis == nil {
+			continue
+		}
+		if first || selection.Policy != last.Policy {
+			redis.PublishState("autoconnect_policy", string(selection.Policy))
+		}
+		if first || selection.Pending != last.Pending {
+			redis.PublishState("phone_selection_pending", fmt.Sprintf("%v", selection.Pending))
+		}
+		last = selection
+		first = false
+	}
+}
+
+// phonePolicyHandler returns or changes the auto-connect policy
+func phonePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Policy   string   `json:"policy"`
+			Priority []string `json:"priority"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+			return
+		}
+		policy, err := link.ParseAutoConnectPolicy(req.Policy)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := phoneSelector.SetPolicy(policy, req.Priority); err != nil {
+			logger("autoconnect").Errorf("Error setting policy: %v", err)
+			http.Error(w, fmt.Sprintf("Failed to set policy: %v", err), errorStatus(err))
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(phoneSelector.GetSelection())
+}
+
+// phoneSelectHandler connects to a chosen paired phone
+func phoneSelectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !dongleReady {
+		http.Error(w, "Dongle not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Address string `json:"address"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Address) == "" {
+		http.Error(w, "Invalid request: expected {\"address\": ...}", http.StatusBadRequest)
+		return
+	}
+
+	if err := phoneSelector.Select(req.Address); err != nil {
+		logger("autoconnect").Errorf("Error selecting %s: %v", req.Address, err)
+		http.Error(w, fmt.Sprintf("Failed to select phone: %v", err), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// errorStatus returns the HTTP status for a failed phone policy change
+func errorStatus(err error) int {
+	if err == link.ErrPairedListWriteDisabled {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"time"
+
+	"github.com/mzyy94/gocarplay"
+	"github.com/mzyy94/gocarplay/link"
+)
+
+var timeSync *link.TimeSync
+
+// initTimeSync starts keeping the dongle clock in sync, fed by GPS fixes from Redis
+func initTimeSync() {
+	var err error
+	timeSync, err = link.NewTimeSync(dongleConfig.TimeSync)
+	if err != nil {
+		logger("timesync").Warnf("%v, using system clock", err)
+		timeSync, _ = link.NewTimeSync(gocarplay.TimeSyncConfig{})
+	}
+	timeSync.Start()
+
+	if dongleConfig.TimeSync.Source != string(link.ClockGPS) {
+		return
+	}
+	field := dongleConfig.TimeSync.GPSTimeField
+	redis.WatchHash(dongleConfig.TimeSync.GPSHash, func(fields map[string]string) {
+		value, ok := fields[field]
+		if !ok || value == "" {
+			return
+		}
+		fix, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			logger("timesync").Warnf("Invalid GPS time %q: %v", value, err)
+			return
+		}
+		timeSync.GPSFix(fix)
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mzyy94/gocarplay/link"
+)
+
+var tracer *link.Tracer
+
+// initTrace sets up the protocol tracer, disabled unless configured
+func initTrace() {
+	tracer = link.NewTracer(dongleConfig.Trace.Size)
+	tracer.SetEnabled(dongleConfig.Trace.Enabled)
+	tracer.Attach()
+}
+
+// traceFilter reads the trace filter from the query string:
+// type=Touch,Command, direction=sent|received, media=0
+func traceFilter(r *http.Request) link.TraceFilter {
+	query := r.URL.Query()
+	filter := link.TraceFilter{
+		Direction:    query.Get("direction"),
+		ExcludeMedia: query.Get("media") == "0" || query.Get("media") == "false",
+	}
+	if types := query.Get("type"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				filter.Types = append(filter.Types, t)
+			}
+		}
+	}
+	return filter
+}
+
+// traceHandler returns the recorded messages, or enables, disables and clears the tracer
+func traceHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"enabled":  tracer.Enabled(),
+			"messages": tracer.Entries(traceFilter(r)),
+		})
+
+	case http.MethodPost:
+		var req struct {
+			Enabled *bool `json:"enabled"`
+			Clear   bool  `json:"clear"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+			return
+		}
+		if req.Clear {
+			tracer.Clear()
+		}
+		if req.Enabled != nil {
+			tracer.SetEnabled(*req.Enabled)
+			logger("server").Infof("Protocol trace enabled: %v", *req.Enabled)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// traceStreamHandler streams messages as they are recorded using Server-Sent Events
+func traceStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	filter := traceFilter(r)
+	entries := tracer.Subscribe()
+	defer tracer.Unsubscribe(entries)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	flusher.Flush()
+
+	for {
+		select {
+		case entry := <-entries:
+			if !filter.Match(entry) {
+				continue
+			}
+			data, err := json.Marshal(entry)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mzyy94/gocarplay/link"
+)
+
+// vehicleRefreshInterval re-reads the telemetry hashes, as an unchanged value, e.g.
+// while parked, is not published again but must not count as stale
+const vehicleRefreshInterval = 2 * time.Second
+
+var vehicleManager *link.VehicleManager
+
+// initVehicle reads vehicle telemetry from Redis and, if enabled, forwards it to the phone
+func initVehicle() {
+	config := dongleConfig.Vehicle
+	vehicleManager = link.NewVehicleManager(config.Forward)
+	if config.Forward {
+		logger("vehicle").Info("Forwarding vehicle info to the phone")
+	}
+
+	// Several signals may live in the same hash, so watch each hash once
+	readers := make(map[string][]func(fields map[string]string, update *link.VehicleUpdate))
+	if signal := config.Speed; signal.Hash != "" {
+		readers[signal.Hash] = append(readers[signal.Hash], func(fields map[string]string, update *link.VehicleUpdate) {
+			if value, err := strconv.ParseFloat(fields[signal.Field], 64); err == nil {
+				update.Speed = &value
+			}
+		})
+	}
+	if signal := config.BatteryLevel; signal.Hash != "" {
+		readers[signal.Hash] = append(readers[signal.Hash], func(fields map[string]string, update *link.VehicleUpdate) {
+			update.BatteryLevel = parseInt32(fields[signal.Field])
+		})
+	}
+	if signal := config.Range; signal.Hash != "" {
+		readers[signal.Hash] = append(readers[signal.Hash], func(fields map[string]string, update *link.VehicleUpdate) {
+			update.Range = parseInt32(fields[signal.Field])
+		})
+	}
+
+	for hash, hashReaders := range readers {
+		hash, hashReaders := hash, hashReaders
+		handler := func(fields map[string]string) {
+			var update link.VehicleUpdate
+			for _, read := range hashReaders {
+				read(fields, &update)
+			}
+			vehicleManager.Update(update)
+		}
+		redis.WatchHash(hash, handler)
+		go refreshHash(hash, handler)
+	}
+}
+
+// refreshHash passes the content of hash to handler every vehicleRefreshInterval,
+// so values are confirmed while unchanged and picked up once Redis is reachable
+func refreshHash(hash string, handler func(fields map[string]string)) {
+	ticker := time.NewTicker(vehicleRefreshInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		fields, err := redis.HGetAll(hash)
+		if err != nil || len(fields) == 0 {
+			continue
+		}
+		handler(fields)
+	}
+}
+
+// parseInt32 parses a telemetry value, rounding fractions down; nil if invalid
+func parseInt32(value string) *int32 {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil
+	}
+	result := int32(number)
+	return &result
+}
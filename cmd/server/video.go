@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/mzyy94/gocarplay/logging"
+)
+
+// transcoderRestartDelay is the pause before restarting an ffmpeg that exited during a session
+const transcoderRestartDelay = time.Second
+
+// videoPipeline converts an H.264 stream from the dongle to JPEG frames with
+// ffmpeg and broadcasts them to MJPEG clients. The main screen and the
+// navigation screen each have their own pipeline.
+type videoPipeline struct {
+	name   string // Used in logs and metric labels, e.g. "navi"
+	prefix string // Metric label prefix, "" for the main screen
+
+	h264Frames chan []byte
+	jpegFrames chan []byte
+	clients    sync.Map // map of client channels
+
+	// ffmpeg process
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	running bool // Between start and stop, an ffmpeg exit in between is a crash
+
+	// Debug counters
+	h264FrameCount int64
+	jpegFrameCount int64
+}
+
+// newVideoPipeline creates a pipeline and starts its frame writer and broadcaster
+func newVideoPipeline(name, prefix string) *videoPipeline {
+	p := &videoPipeline{
+		name:   name,
+		prefix: prefix,
+		// Minimal buffers for low latency
+		// 3 frames = ~100ms at 30fps
+		// Small buffers are critical to avoid lag - we want real-time streaming!
+		h264Frames: make(chan []byte, 3),
+		jpegFrames: make(chan []byte, 3),
+	}
+	go p.writeH264()
+	go p.broadcastFrames()
+	return p
+}
+
+// start launches the ffmpeg converter, restarting it if it exits before stop
+func (p *videoPipeline) start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.running = true
+	return p.launch()
+}
+
+// launch starts the ffmpeg process. The caller must hold p.mu.
+func (p *videoPipeline) launch() error {
+	// ffmpeg command: read H.264 from stdin, output JPEG frames to stdout
+	// -f h264 explicitly tells ffmpeg the input is raw H.264 Annex-B stream
+	cmd := exec.Command("ffmpeg",
+		"-f", "h264",
+		"-threads", "4",
+		"-i", "pipe:0",
+		"-f", "image2pipe",
+		"-vcodec", "mjpeg",
+		"-q:v", "5",
+		"pipe:1",
+	)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get stdin pipe: %v", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get stdout pipe: %v", err)
+	}
+
+	// Capture stderr for debugging
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get stderr pipe: %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %v", err)
+	}
+	p.cmd = cmd
+	p.stdin = stdin
+
+	p.logger().Info("Started ffmpeg converter process with 256KB buffered I/O")
+
+	// Log ffmpeg errors in background
+	go func() {
+		scanner := bufio.NewScanner(stderrPipe)
+		for scanner.Scan() {
+			line := scanner.Text()
+			// Only log important messages, skip verbose output
+			if len(line) > 0 && line[0] != ' ' {
+				p.logger().Infof("ffmpeg: %s", line)
+			}
+		}
+	}()
+
+	// Wrap stdout with a large buffered reader (256KB) for efficient I/O
+	// This reduces kernel overhead and improves streaming performance
+	go func() {
+		p.readJPEG(bufio.NewReaderSize(stdout, 256*1024))
+		p.exited(cmd, cmd.Wait())
+	}()
+
+	return nil
+}
+
+// exited restarts ffmpeg if it exited on its own while the pipeline is running
+func (p *videoPipeline) exited(cmd *exec.Cmd, err error) {
+	p.mu.Lock()
+	crashed := p.running && p.cmd == cmd
+	if crashed {
+		p.cmd = nil
+		p.stdin = nil
+	}
+	p.mu.Unlock()
+
+	if !crashed {
+		return
+	}
+	p.logger().Warnf("ffmpeg exited unexpectedly (%v), restarting in %v", err, transcoderRestartDelay)
+	time.Sleep(transcoderRestartDelay)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.running || p.cmd != nil {
+		return
+	}
+	transcoderRestarts.Inc()
+	if err := p.launch(); err != nil {
+		p.logger().Errorf("Failed to restart ffmpeg: %v", err)
+	}
+}
+
+// stop kills the ffmpeg converter and discards queued frames
+func (p *videoPipeline) stop() {
+	p.logger().Info("Stopping video pipeline...")
+
+	p.mu.Lock()
+	p.running = false
+	if p.stdin != nil {
+		p.stdin.Close()
+		p.stdin = nil
+	}
+	if p.cmd != nil && p.cmd.Process != nil {
+		// The goroutine started by launch reaps the process
+		p.cmd.Process.Kill()
+		p.cmd = nil
+	}
+	p.mu.Unlock()
+
+	// Drain channels
+	for len(p.h264Frames) > 0 {
+		<-p.h264Frames
+	}
+	for len(p.jpegFrames) > 0 {
+		<-p.jpegFrames
+	}
+
+	// Reset counters
+	p.h264FrameCount = 0
+	p.jpegFrameCount = 0
+
+	p.logger().Info("Video pipeline stopped")
+}
+
+// push queues an H.264 frame for conversion, replacing frames not yet converted
+func (p *videoPipeline) push(frame []byte) {
+	p.h264FrameCount++
+
+	// Warn about suspiciously small H.264 frames
+	if len(frame) > 0 && len(frame) < 100 && p.h264FrameCount > 10 {
+		if p.h264FrameCount%100 == 0 {
+			p.logger().Warnf("H.264 frame #%d is very small (%d bytes)", p.h264FrameCount, len(frame))
+		}
+	}
+
+	// Diagnostic for first 10 frames
+	if p.h264FrameCount <= 10 && len(frame) >= 5 {
+		nalType := "unknown"
+		if frame[0] == 0 && frame[1] == 0 {
+			nalUnitType := frame[4] & 0x1F
+			switch nalUnitType {
+			case 1:
+				nalType = "P-frame"
+			case 5:
+				nalType = "I-frame"
+			case 7:
+				nalType = "SPS"
+			case 8:
+				nalType = "PPS"
+			}
+		}
+		p.logger().Infof("H.264 frame #%d: NAL=%s, Size=%d", p.h264FrameCount, nalType, len(frame))
+	}
+
+	// Only send non-empty frames
+	if len(frame) == 0 {
+		return
+	}
+
+	// Drain old frames
+	drained := 0
+drainLoop:
+	for {
+		select {
+		case <-p.h264Frames:
+			drained++
+		default:
+			break drainLoop
+		}
+	}
+	droppedFrames.With(p.prefix + "h264").Add(uint64(drained))
+
+	// Send latest frame
+	select {
+	case p.h264Frames <- frame:
+	default:
+		droppedFrames.With(p.prefix + "h264").Inc()
+		p.logger().Debug("Dropped H.264 frame")
+	}
+}
+
+func (p *videoPipeline) writeH264() {
+	for frame := range p.h264Frames {
+		// Get pipe reference with mutex, but don't hold it during blocking write
+		// This prevents deadlock when ffmpeg blocks on stdin
+		p.mu.Lock()
+		stdin := p.stdin
+		p.mu.Unlock()
+
+		if stdin != nil {
+			if _, err := stdin.Write(frame); err != nil {
+				p.logger().Errorf("Error writing H.264 frame: %v", err)
+				continue
+			}
+		}
+	}
+}
+
+// readJPEG reads converted frames until the ffmpeg process exits
+func (p *videoPipeline) readJPEG(stdout *bufio.Reader) {
+	for {
+		// Read JPEG frame from buffered ffmpeg stdout
+		// JPEG format: starts with FF D8, ends with FF D9
+		jpeg, err := readJPEGFrame(stdout)
+		if err != nil {
+			if err == io.EOF || errors.Is(err, os.ErrClosed) {
+				p.logger().Debug("ffmpeg output closed")
+			} else {
+				p.logger().Errorf("Error reading JPEG frame: %v", err)
+			}
+			return
+		}
+
+		p.jpegFrameCount++
+
+		// Validate JPEG frame markers
+		if p.jpegFrameCount <= 5 || p.jpegFrameCount%100 == 0 {
+			hasValidStart := len(jpeg) >= 2 && jpeg[0] == 0xFF && jpeg[1] == 0xD8
+			hasValidEnd := len(jpeg) >= 2 && jpeg[len(jpeg)-2] == 0xFF && jpeg[len(jpeg)-1] == 0xD9
+			p.logger().Infof("JPEG frame #%d: size=%d, validStart=%v, validEnd=%v, first4bytes=[%02X %02X %02X %02X]",
+				p.jpegFrameCount, len(jpeg), hasValidStart, hasValidEnd,
+				jpeg[0], jpeg[1], jpeg[2], jpeg[3])
+		}
+
+		if p.jpegFrameCount%500 == 1 {
+			p.logger().Debugf("Converted JPEG frame #%d, size: %d bytes", p.jpegFrameCount, len(jpeg))
+		}
+
+		// CRITICAL: Drain old JPEG frames to prioritize the latest
+		drained := 0
+	drainJpegLoop:
+		for {
+			select {
+			case <-p.jpegFrames:
+				drained++
+			default:
+				break drainJpegLoop
+			}
+		}
+
+		droppedFrames.With(p.prefix + "jpeg").Add(uint64(drained))
+		if drained > 0 {
+			p.logger().Debugf("Drained %d old JPEG frames to prioritize latest", drained)
+		}
+
+		// Send to broadcast channel (non-blocking)
+		select {
+		case p.jpegFrames <- jpeg:
+		default:
+			// Drop frame if buffer is full
+			droppedFrames.With(p.prefix + "jpeg").Inc()
+			p.logger().Debug("Dropped JPEG frame, channel full after drain")
+		}
+	}
+}
+
+func readJPEGFrame(reader io.Reader) ([]byte, error) {
+	// SIMPLE BYTE-BY-BYTE READING - most reliable approach
+	// Testing version to isolate if buffered reading was causing issues
+
+	var buf bytes.Buffer
+	b := make([]byte, 1)
+
+	// Find JPEG start marker (FF D8)
+	for {
+		if _, err := reader.Read(b); err != nil {
+			return nil, err
+		}
+		if b[0] == 0xFF {
+			if _, err := reader.Read(b); err != nil {
+				return nil, err
+			}
+			if b[0] == 0xD8 {
+				// Found start marker
+				buf.Write([]byte{0xFF, 0xD8})
+				break
+			}
+		}
+	}
+
+	// Read until we find end marker (FF D9)
+	prevByte := byte(0)
+	for {
+		if _, err := reader.Read(b); err != nil {
+			return nil, err
+		}
+		buf.WriteByte(b[0])
+
+		if prevByte == 0xFF && b[0] == 0xD9 {
+			// Found end marker, JPEG is complete
+			return buf.Bytes(), nil
+		}
+		prevByte = b[0]
+	}
+}
+
+// Broadcast JPEG frames to all connected clients
+func (p *videoPipeline) broadcastFrames() {
+	for frame := range p.jpegFrames {
+		p.clients.Range(func(key, value interface{}) bool {
+			clientChan := value.(chan []byte)
+
+			// Drain old frames from this client's channel to prioritize latest
+			drained := 0
+		drainClientLoop:
+			for {
+				select {
+				case <-clientChan:
+					drained++
+				default:
+					break drainClientLoop
+				}
+			}
+
+			if drained > 0 {
+				droppedFrames.With(p.prefix + "client").Add(uint64(drained))
+				clientDroppedFrames.With(key.(string)).Add(uint64(drained))
+			}
+
+			// Now send the latest frame (non-blocking)
+			select {
+			case clientChan <- frame:
+			default:
+				// Skip if client is still slow after draining
+				droppedFrames.With(p.prefix + "client").Inc()
+				clientDroppedFrames.With(key.(string)).Inc()
+			}
+			return true
+		})
+	}
+}
+
+// clientCount returns the number of connected MJPEG clients
+func (p *videoPipeline) clientCount() int {
+	var count int
+	p.clients.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// serveMJPEG streams JPEG frames to a client until it disconnects
+func (p *videoPipeline) serveMJPEG(w http.ResponseWriter, r *http.Request) {
+	// Set headers for MJPEG streaming
+	boundary := "frame"
+	w.Header().Set("Content-Type", fmt.Sprintf("multipart/x-mixed-replace; boundary=%s", boundary))
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	clientID := p.prefix + fmt.Sprintf("%p", r)
+	logger("stream").Infof("New MJPEG client connected to %s stream: %s", p.name, clientID)
+
+	// Create channel for this client with minimal buffer for low latency
+	// 2 frames = ~66ms at 30fps
+	clientChan := make(chan []byte, 2)
+	p.clients.Store(clientID, clientChan)
+
+	// Clean up on disconnect
+	defer func() {
+		p.clients.Delete(clientID)
+		clientDroppedFrames.Delete(clientID)
+		close(clientChan)
+		logger("stream").Infof("Client disconnected: %s", clientID)
+	}()
+
+	// Create multipart writer
+	mw := multipart.NewWriter(w)
+	mw.SetBoundary(boundary)
+
+	// Stream JPEG frames to client
+	framesSent := int64(0)
+	for {
+		select {
+		case frame := <-clientChan:
+			framesSent++
+
+			// Log first 5 frames and every 100th frame
+			if framesSent <= 5 || framesSent%100 == 0 {
+				logger("stream").Infof("Sending frame #%d to client %s: size=%d bytes",
+					framesSent, clientID, len(frame))
+			}
+
+			// Create part header
+			partHeader := make(textproto.MIMEHeader)
+			partHeader.Add("Content-Type", "image/jpeg")
+			partHeader.Add("Content-Length", fmt.Sprintf("%d", len(frame)))
+
+			part, err := mw.CreatePart(partHeader)
+			if err != nil {
+				logger("stream").Errorf("Error creating part: %v", err)
+				return
+			}
+
+			// Write JPEG data
+			if _, err := part.Write(frame); err != nil {
+				logger("stream").Errorf("Error writing frame: %v", err)
+				return
+			}
+
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// logger returns the logger of the pipeline, "video" for the main screen
+func (p *videoPipeline) logger() *logging.Logger {
+	if p.prefix == "" {
+		return logger("video")
+	}
+	return logger("video").With("stream", p.name)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/mzyy94/gocarplay/link"
+)
+
+var wirelessManager *link.WirelessManager
+
+// initWireless sets up the wireless session manager and publishes its state
+func initWireless() {
+	wirelessManager = link.NewWirelessManager(dongleConfig, bluetoothManager)
+
+	events := dispatcher.Subscribe()
+	go func() {
+		for event := range events {
+			wirelessManager.HandleEvent(event)
+		}
+	}()
+
+	go publishWireless(wirelessManager.Subscribe())
+
+	registerCommand("wifi-disconnect", func(args []string) error {
+		return wirelessManager.Disconnect()
+	})
+}
+
+// publishWireless publishes changed wireless state to Redis
+func publishWireless(updates chan link.WirelessInfo) {
+	var last link.WirelessInfo
+
+	for info := range updates {
+		if redis == nil {
+			continue
+		}
+		if info.Status != last.Status {
+			redis.PublishState("wireless_status", info.Status.String())
+		}
+		if info.DeviceName != last.DeviceName {
+			redis.PublishState("wifi_device_name", info.DeviceName)
+		}
+		if info.LastPhone != last.LastPhone {
+			redis.PublishState("wireless_last_phone", info.LastPhone)
+		}
+		last = info
+	}
+}
+
+// wirelessStatus returns the wireless session for the status endpoint
+func wirelessStatus() map[string]interface{} {
+	info := wirelessManager.GetInfo()
+	return map[string]interface{}{
+		"status":      info.Status.String(),
+		"device_name": info.DeviceName,
+		"last_phone":  info.LastPhone,
+		"attempts":    info.Attempts,
+		"preference":  info.Preference,
+	}
+}
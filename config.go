@@ -1,12 +1,276 @@
 package gocarplay
 
-import "github.com/mzyy94/gocarplay/protocol"
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
 
 // PhoneTypeConfig contains phone-specific configuration
 type PhoneTypeConfig struct {
 	FrameInterval *int `json:"frameInterval"`
 }
 
+// USBDeviceConfig describes a supported dongle model and its per-model USB quirks
+type USBDeviceConfig struct {
+	VendorID           uint16 `json:"vendorId"`
+	ProductID          uint16 `json:"productId"`
+	Name               string `json:"name"`
+	Interface          int    `json:"interface"`
+	AltSetting         int    `json:"altSetting"`
+	EndpointIn         uint8  `json:"endpointIn"`  // IN endpoint address, e.g. 0x81 or "81" (0 = default)
+	EndpointOut        uint8  `json:"endpointOut"` // OUT endpoint address, e.g. 0x01 or "01" (0 = default)
+	DetachKernelDriver bool   `json:"detachKernelDriver"`
+}
+
+// InEndpointNumber returns the IN endpoint number (address without direction bit)
+func (d USBDeviceConfig) InEndpointNumber() int {
+	if d.EndpointIn == 0 {
+		return 1
+	}
+	return int(d.EndpointIn & 0x0f)
+}
+
+// OutEndpointNumber returns the OUT endpoint number
+func (d USBDeviceConfig) OutEndpointNumber() int {
+	if d.EndpointOut == 0 {
+		return 1
+	}
+	return int(d.EndpointOut & 0x0f)
+}
+
+// String returns the VID:PID representation of the device
+func (d USBDeviceConfig) String() string {
+	if d.Name != "" {
+		return fmt.Sprintf("%04x:%04x (%s)", d.VendorID, d.ProductID, d.Name)
+	}
+	return fmt.Sprintf("%04x:%04x", d.VendorID, d.ProductID)
+}
+
+// UnmarshalJSON decodes a device descriptor. IDs and endpoint addresses may be
+// given as numbers or as hex strings, e.g. "vendorId": "0x1314" or "1314".
+func (d *USBDeviceConfig) UnmarshalJSON(data []byte) error {
+	type plain USBDeviceConfig
+	aux := struct {
+		*plain
+		VendorID    json.RawMessage `json:"vendorId"`
+		ProductID   json.RawMessage `json:"productId"`
+		EndpointIn  json.RawMessage `json:"endpointIn"`
+		EndpointOut json.RawMessage `json:"endpointOut"`
+	}{plain: (*plain)(d)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	fields := []struct {
+		name string
+		raw  json.RawMessage
+		bits int
+		set  func(uint64)
+	}{
+		{"vendorId", aux.VendorID, 16, func(v uint64) { d.VendorID = uint16(v) }},
+		{"productId", aux.ProductID, 16, func(v uint64) { d.ProductID = uint16(v) }},
+		{"endpointIn", aux.EndpointIn, 8, func(v uint64) { d.EndpointIn = uint8(v) }},
+		{"endpointOut", aux.EndpointOut, 8, func(v uint64) { d.EndpointOut = uint8(v) }},
+	}
+	for _, field := range fields {
+		if len(field.raw) == 0 {
+			continue
+		}
+		var value uint64
+		var hex string
+		if err := json.Unmarshal(field.raw, &hex); err == nil {
+			value, err = strconv.ParseUint(strings.TrimPrefix(strings.ToLower(hex), "0x"), 16, field.bits)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %v", field.name, hex, err)
+			}
+		} else if err := json.Unmarshal(field.raw, &value); err != nil {
+			return fmt.Errorf("invalid %s %s: %v", field.name, field.raw, err)
+		} else if value>>uint(field.bits) != 0 {
+			return fmt.Errorf("invalid %s %d: out of range", field.name, value)
+		}
+		field.set(value)
+	}
+	return nil
+}
+
+// ParseUSBDevices parses a comma-separated list of "vid:pid" hex pairs,
+// e.g. "1314:1520,08e4:01c0", as used by the USB_DEVICES environment variable.
+// Quirks may follow as colon-separated options, with hex endpoint addresses:
+//
+//	1314:1520:name=Carlinkit:interface=0:alt=0:in=81:out=01:detach
+func ParseUSBDevices(list string) ([]USBDeviceConfig, error) {
+	var devices []USBDeviceConfig
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid USB device %q, expected vid:pid[:option...]", entry)
+		}
+		vid, err := strconv.ParseUint(strings.TrimPrefix(parts[0], "0x"), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vendor ID in %q: %v", entry, err)
+		}
+		pid, err := strconv.ParseUint(strings.TrimPrefix(parts[1], "0x"), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid product ID in %q: %v", entry, err)
+		}
+		device := USBDeviceConfig{VendorID: uint16(vid), ProductID: uint16(pid)}
+		for _, option := range parts[2:] {
+			if err := device.parseOption(option); err != nil {
+				return nil, fmt.Errorf("invalid option in %q: %v", entry, err)
+			}
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// parseOption applies a USB_DEVICES quirk option such as "in=81" or "detach"
+func (d *USBDeviceConfig) parseOption(option string) error {
+	key, value := option, ""
+	if i := strings.Index(option, "="); i >= 0 {
+		key, value = option[:i], option[i+1:]
+	}
+
+	var err error
+	parseInt := func() int {
+		var n int
+		n, err = strconv.Atoi(value)
+		return n
+	}
+	parseEndpoint := func() uint8 {
+		var n uint64
+		n, err = strconv.ParseUint(strings.TrimPrefix(value, "0x"), 16, 8)
+		return uint8(n)
+	}
+
+	switch key {
+	case "name":
+		d.Name = value
+	case "interface":
+		d.Interface = parseInt()
+	case "alt":
+		d.AltSetting = parseInt()
+	case "in":
+		d.EndpointIn = parseEndpoint()
+	case "out":
+		d.EndpointOut = parseEndpoint()
+	case "detach":
+		d.DetachKernelDriver = value == "" || value == "true" || value == "1"
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+	return nil
+}
+
+// AutoConnectConfig selects which paired phone the dongle connects to
+type AutoConnectConfig struct {
+	Policy   string   `json:"policy"`   // "priority", "last_used" or "ask"
+	Priority []string `json:"priority"` // Bluetooth addresses in priority order, for the "priority" policy
+}
+
+// CompatibilityRule enables or disables features for a range of dongle firmware versions
+type CompatibilityRule struct {
+	MinVersion string   `json:"minVersion"` // Inclusive lower bound, "" = unbounded
+	MaxVersion string   `json:"maxVersion"` // Inclusive upper bound, "" = unbounded
+	Disable    []string `json:"disable"`    // Features to disable, e.g. "multi_touch", "audio_transfer"
+	Warning    string   `json:"warning"`    // Logged and published for known-bad builds
+}
+
+// BrandingConfig describes the OEM icon and names shown by the phone
+type BrandingConfig struct {
+	IconFile string `json:"iconFile"` // PNG resized and uploaded as the OEM icon, "" = no icon
+	Label    string `json:"label"`    // Label shown below the OEM icon
+	Name     string `json:"name"`     // Accessory name reported to the phone
+	Model    string `json:"model"`    // Accessory model reported to the phone
+
+	IconVisible *bool `json:"iconVisible"` // Show the OEM icon and label, nil = true
+}
+
+// TimeSyncConfig controls how the dongle clock is kept in sync
+type TimeSyncConfig struct {
+	Interval     int32  `json:"interval"`     // ms between periodic syncs, 0 = default
+	Timezone     string `json:"timezone"`     // IANA zone whose wall-clock time is sent, "" = UTC
+	Source       string `json:"source"`       // "system" or "gps"
+	GPSHash      string `json:"gpsHash"`      // Redis hash holding the GPS fix
+	GPSTimeField string `json:"gpsTimeField"` // RFC 3339 fix time field in GPSHash
+}
+
+// AssistantConfig controls the voice assistant button and microphone uplink
+type AssistantConfig struct {
+	Mode          string `json:"mode"`          // "tap" or "push_to_talk"
+	ButtonChannel string `json:"buttonChannel"` // Redis channel publishing "<button>:on" / "<button>:off"
+	Button        string `json:"button"`        // Button triggering the assistant, "" = none
+	MicCommand    string `json:"micCommand"`    // Command writing 16 kHz mono s16le PCM to stdout, "" = no uplink
+	SiriLogo      bool   `json:"siriLogo"`      // Send LogoType Siri after configuration, effect depends on the firmware
+}
+
+// GNSSConfig controls forwarding of vehicle GNSS data to the phone
+type GNSSConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Source   string `json:"source"`   // "redis" or "nmea"
+	Hash     string `json:"hash"`     // Redis hash holding the GPS fix, for the "redis" source
+	Device   string `json:"device"`   // Serial device or pipe producing NMEA sentences, for the "nmea" source
+	Interval int32  `json:"interval"` // Minimum ms between messages sent to the phone, 0 = default
+}
+
+// VehicleSignalConfig locates a telemetry value in Redis
+type VehicleSignalConfig struct {
+	Hash  string `json:"hash"`  // Redis hash, "" = not available
+	Field string `json:"field"` // Field of the hash holding the value
+}
+
+// VehicleConfig locates the vehicle telemetry, used by the input policy and
+// optionally forwarded to the phone
+type VehicleConfig struct {
+	Speed        VehicleSignalConfig `json:"speed"`        // km/h
+	BatteryLevel VehicleSignalConfig `json:"batteryLevel"` // State of charge in percent
+	Range        VehicleSignalConfig `json:"range"`        // Remaining range in km
+	Forward      bool                `json:"forward"`      // Send VehicleInfo messages, an undocumented format
+
+	// TouchSpeedLimit is the former touch gate speed in km/h.
+	// Deprecated: use InputPolicy.SpeedLimit, which LoadFile sets from it.
+	TouchSpeedLimit *float64 `json:"touchSpeedLimit,omitempty"`
+}
+
+// InputPolicyConfig restricts touch and key input while riding
+type InputPolicyConfig struct {
+	Mode            string   `json:"mode"`            // "block" or "rate_limit"
+	SpeedLimit      float64  `json:"speedLimit"`      // km/h above which input is restricted, 0 = never
+	RateLimit       int      `json:"rateLimit"`       // Gestures allowed per window in "rate_limit" mode
+	RateWindow      int32    `json:"rateWindow"`      // ms, 0 = default
+	AllowedCommands []string `json:"allowedCommands"` // Commands allowed at any speed, e.g. "BtnPlayOrPause", nil = media keys, calls and assistant
+	AuditList       string   `json:"auditList"`       // Redis list receiving blocked events, "" = none
+	SpeedMaxAge     int32    `json:"speedMaxAge"`     // ms without a speed reading before it counts as unknown, 0 = never
+	AllowUnknown    bool     `json:"allowUnknown"`    // Leave input unrestricted while the speed is unknown
+}
+
+// NaviScreenConfig requests the secondary navigation video stream
+type NaviScreenConfig struct {
+	Enabled bool  `json:"enabled"`
+	Width   int32 `json:"width"`
+	Height  int32 `json:"height"`
+	Fps     int32 `json:"fps"`
+}
+
+// TraceConfig controls the protocol tracer behind /debug/trace
+type TraceConfig struct {
+	Enabled bool `json:"enabled"` // Record messages from startup
+	Size    int  `json:"size"`    // Messages kept in the ring buffer, 0 = default
+}
+
 // DongleConfig contains all configuration for the CarPlay dongle
 type DongleConfig struct {
 	AndroidWorkMode        bool                            `json:"androidWorkMode"`
@@ -28,6 +292,29 @@ type DongleConfig struct {
 	WifiChannel            int32                           `json:"wifiChannel"`
 	MicType                string                          `json:"micType"` // "box" or "os"
 	PhoneConfig            map[protocol.PhoneType]*PhoneTypeConfig `json:"phoneConfig"`
+	USBDevices             []USBDeviceConfig               `json:"usbDevices"` // Additional or overriding dongle descriptors
+	LivenessTimeout        int32                           `json:"livenessTimeout"` // ms without dongle messages before recovery starts, 0 = default
+	IdleLivenessTimeout    int32                           `json:"idleLivenessTimeout"` // ms without dongle messages while no phone is attached, 0 = default
+	WirelessEnabled        bool                            `json:"wirelessEnabled"` // Enable wireless CarPlay/Android Auto
+	WifiRetryMinBackoff    int32                           `json:"wifiRetryMinBackoff"` // ms before the first wireless retry, 0 = default
+	WifiRetryMaxBackoff    int32                           `json:"wifiRetryMaxBackoff"` // ms cap for wireless retry backoff, 0 = default
+	PairedListReorder      bool                            `json:"pairedListReorder"` // Rewrite the paired list to prefer or forget phones, unverified on firmware
+	AutoConnect            AutoConnectConfig               `json:"autoConnect"`
+	StateFile              string                          `json:"stateFile"` // Persistent service state (auto-connect policy, last phone)
+	Compatibility          []CompatibilityRule             `json:"compatibility"` // Additional firmware compatibility rules
+	Branding               BrandingConfig                  `json:"branding"`
+	FileAllowList          []string                        `json:"fileAllowList"` // Additional dongle paths writable through the file API
+	AirplayOptions         map[string]string               `json:"airplayOptions"` // Additional airplay.conf options
+	MediaSound             *int32                          `json:"mediaSound"` // BoxSettings mediaSound, nil = firmware default
+	CallQuality            *int32                          `json:"callQuality"` // BoxSettings callQuality, nil = firmware default
+	AutoConn               *bool                           `json:"autoConn"` // BoxSettings autoConn, nil = firmware default
+	TimeSync               TimeSyncConfig                  `json:"timeSync"`
+	Assistant              AssistantConfig                 `json:"assistant"`
+	Trace                  TraceConfig                     `json:"trace"`
+	GNSS                   GNSSConfig                      `json:"gnss"`
+	Vehicle                VehicleConfig                   `json:"vehicle"`
+	InputPolicy            InputPolicyConfig               `json:"inputPolicy"`
+	NaviScreen             NaviScreenConfig                `json:"naviScreen"`
 }
 
 // DefaultConfig returns the default configuration for the dongle
@@ -50,7 +337,20 @@ func DefaultConfig() *DongleConfig {
 		AutoDetectAndroidMode: true, // Enable auto-detection by default
 		WifiType:      "5ghz",
 		WifiChannel:   36,
+		WirelessEnabled: true,
 		MicType:       "os",
+		AutoConnect:   AutoConnectConfig{Policy: "last_used"},
+		StateFile:     "/var/lib/carplay-service/state.json",
+		Branding:      BrandingConfig{Name: "AutoBox", Model: "GoCarPlay-1.00"},
+		TimeSync:      TimeSyncConfig{Source: "system", GPSHash: "gps", GPSTimeField: "timestamp"},
+		Assistant:     AssistantConfig{Mode: "tap", ButtonChannel: "buttons"},
+		GNSS:          GNSSConfig{Source: "redis", Hash: "gps"},
+		Vehicle: VehicleConfig{
+			Speed:        VehicleSignalConfig{Hash: "engine-ecu", Field: "speed"},
+			BatteryLevel: VehicleSignalConfig{Hash: "battery:0", Field: "charge"},
+		},
+		InputPolicy: InputPolicyConfig{Mode: "block", SpeedLimit: 5, RateLimit: 1, AuditList: "carplay:input-audit", SpeedMaxAge: 10000},
+		NaviScreen:  NaviScreenConfig{Width: 480, Height: 272, Fps: 30},
 		PhoneConfig: map[protocol.PhoneType]*PhoneTypeConfig{
 			protocol.PhoneTypeCarPlay: {FrameInterval: &frameInterval5000},
 			protocol.AndroidAuto: {FrameInterval: nil},
@@ -58,6 +358,58 @@ func DefaultConfig() *DongleConfig {
 	}
 }
 
+// AirplayConfig returns the airplay.conf content for the configured branding.
+// Additional options are sorted by key so the output is deterministic; options
+// named like a branding field are left out, the branding field wins.
+func (c *DongleConfig) AirplayConfig() *protocol.AirplayConfig {
+	airplay := &protocol.AirplayConfig{
+		OEMIconVisible: c.Branding.IconVisible == nil || *c.Branding.IconVisible,
+		Name:           c.Branding.Name,
+		Model:          c.Branding.Model,
+		OEMIconPath:    string(protocol.FileAddressOEMIcon),
+		OEMIconLabel:   c.Branding.Label,
+	}
+
+	keys := make([]string, 0, len(c.AirplayOptions))
+	for key := range c.AirplayOptions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if protocol.IsAirplayKey(key) {
+			continue
+		}
+		airplay.Extra = append(airplay.Extra, protocol.AirplayOption{Key: key, Value: c.AirplayOptions[key]})
+	}
+	return airplay
+}
+
+// LoadFile overlays the JSON configuration file at path onto the config.
+// Fields missing from the file keep their current values.
+func (c *DongleConfig) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+
+	// The deprecated vehicle.touchSpeedLimit applies unless inputPolicy.speedLimit is set
+	if c.Vehicle.TouchSpeedLimit != nil {
+		var aux struct {
+			InputPolicy struct {
+				SpeedLimit *float64 `json:"speedLimit"`
+			} `json:"inputPolicy"`
+		}
+		json.Unmarshal(data, &aux)
+		if aux.InputPolicy.SpeedLimit == nil {
+			c.InputPolicy.SpeedLimit = *c.Vehicle.TouchSpeedLimit
+		}
+	}
+	return nil
+}
+
 // GetWifiChannel returns the appropriate WiFi channel based on the WifiType
 func (c *DongleConfig) GetWifiChannel() int32 {
 	if c.WifiChannel > 0 {
@@ -0,0 +1,228 @@
+package link
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// AssistantMode selects how the assistant button behaves
+type AssistantMode string
+
+const (
+	// AssistantTap starts the assistant on a press; the phone decides when the user stopped talking
+	AssistantTap AssistantMode = "tap"
+	// AssistantPushToTalk starts the assistant on a press and sends microphone audio only while the button is held.
+	// It is a microphone gate only: no end-of-utterance command is known, so after the
+	// release the phone still ends the request on silence or its own timeout.
+	AssistantPushToTalk AssistantMode = "push_to_talk"
+)
+
+// ParseAssistantMode parses a mode name, an empty name selects AssistantTap
+func ParseAssistantMode(name string) (AssistantMode, error) {
+	switch AssistantMode(name) {
+	case "", AssistantTap:
+		return AssistantTap, nil
+	case AssistantPushToTalk:
+		return AssistantPushToTalk, nil
+	}
+	return "", fmt.Errorf("unknown assistant mode: %s", name)
+}
+
+// AssistantInfo is a snapshot of the voice assistant session
+type AssistantInfo struct {
+	Active    bool `json:"active"`     // Siri or Google Assistant is running on the phone
+	Held      bool `json:"held"`       // The assistant button is pressed
+	Recording bool `json:"recording"`  // The phone requested microphone audio
+	MicUplink bool `json:"mic_uplink"` // Microphone audio is being sent to the phone
+}
+
+// AssistantManager triggers the phone's voice assistant from a button and
+// starts and stops the microphone uplink as the phone requests audio
+type AssistantManager struct {
+	mu        sync.Mutex
+	mode      AssistantMode
+	info      AssistantInfo
+	siriLogo  bool
+	onUplink  func(active bool)
+	listeners []chan AssistantInfo
+}
+
+// NewAssistantManager creates a new assistant manager for the given button mode
+func NewAssistantManager(mode AssistantMode) *AssistantManager {
+	return &AssistantManager{
+		mode:      mode,
+		listeners: make([]chan AssistantInfo, 0),
+	}
+}
+
+// SetUplinkHandler sets the function starting and stopping the microphone uplink
+func (am *AssistantManager) SetUplinkHandler(onUplink func(active bool)) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.onUplink = onUplink
+}
+
+// SetSiriLogo selects whether Configure announces the Siri logo to the dongle
+func (am *AssistantManager) SetSiriLogo(enabled bool) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.siriLogo = enabled
+}
+
+// Configure sends the assistant settings to a freshly configured dongle.
+// The LogoType effect differs between firmwares, so it is only sent when enabled.
+func (am *AssistantManager) Configure() error {
+	am.mu.Lock()
+	siriLogo := am.siriLogo
+	am.mu.Unlock()
+
+	if !siriLogo {
+		return nil
+	}
+	return SendLogoType(protocol.LogoSiri)
+}
+
+// GetInfo returns a snapshot of the assistant session
+func (am *AssistantManager) GetInfo() AssistantInfo {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	return am.info
+}
+
+// Press handles the assistant button being pressed
+func (am *AssistantManager) Press() error {
+	info := am.GetInfo()
+	am.update(func(info *AssistantInfo) {
+		info.Held = true
+	})
+	if info.Active {
+		// Push-to-talk resumes the uplink; a tap while active is left to the phone
+		return nil
+	}
+	logger("assistant").Info("Starting voice assistant")
+	return SendCommand(protocol.BtnSiri)
+}
+
+// Release handles the assistant button being released.
+// It only closes the push-to-talk microphone gate, the phone is not told to stop listening.
+func (am *AssistantManager) Release() {
+	am.update(func(info *AssistantInfo) {
+		info.Held = false
+	})
+}
+
+// Tap handles a short press and release of the assistant button
+func (am *AssistantManager) Tap() error {
+	err := am.Press()
+	am.Release()
+	return err
+}
+
+// Reset ends the assistant session, e.g. after the phone is unplugged
+func (am *AssistantManager) Reset() {
+	am.update(func(info *AssistantInfo) {
+		*info = AssistantInfo{}
+	})
+}
+
+// HandleMessage updates the assistant state from assistant audio commands.
+// It returns false if the message is not assistant related.
+func (am *AssistantManager) HandleMessage(msg interface{}) bool {
+	audio, ok := msg.(*protocol.AudioData)
+	if !ok {
+		return false
+	}
+
+	switch audio.Command {
+	case protocol.AudioSiriStart:
+		am.update(func(info *AssistantInfo) {
+			info.Active = true
+		})
+	case protocol.AudioSiriStop:
+		am.update(func(info *AssistantInfo) {
+			info.Active = false
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+// HandleEvent updates the microphone state from a dispatched dongle event
+func (am *AssistantManager) HandleEvent(event Event) {
+	mic, ok := event.(MicrophoneEvent)
+	if !ok {
+		return
+	}
+	am.update(func(info *AssistantInfo) {
+		info.Recording = mic.Recording
+	})
+}
+
+// uplink reports whether microphone audio should be sent for the state.
+// In push-to-talk mode the assistant only hears the user while the button is held;
+// other recording requests, such as calls, are always served.
+func (am *AssistantManager) uplink(info AssistantInfo) bool {
+	if !info.Recording {
+		return false
+	}
+	if am.mode == AssistantPushToTalk && info.Active {
+		return info.Held
+	}
+	return true
+}
+
+// update applies fn to the assistant state, drives the uplink and notifies listeners on change
+func (am *AssistantManager) update(fn func(info *AssistantInfo)) {
+	am.mu.Lock()
+	old := am.info
+	fn(&am.info)
+	am.info.MicUplink = am.uplink(am.info)
+	info := am.info
+	onUplink := am.onUplink
+	listeners := am.listeners
+	am.mu.Unlock()
+
+	if old == info {
+		return
+	}
+	if old.Active != info.Active {
+		logger("assistant").Infof("Active: %v", info.Active)
+	}
+	if old.MicUplink != info.MicUplink && onUplink != nil {
+		onUplink(info.MicUplink)
+	}
+	for _, ch := range listeners {
+		select {
+		case ch <- info:
+		default:
+			// Skip if channel is full
+		}
+	}
+}
+
+// Subscribe creates a new channel that will receive assistant state notifications
+func (am *AssistantManager) Subscribe() chan AssistantInfo {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	ch := make(chan AssistantInfo, 10)
+	am.listeners = append(am.listeners, ch)
+	return ch
+}
+
+// Unsubscribe removes a listener channel
+func (am *AssistantManager) Unsubscribe(ch chan AssistantInfo) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	for i, listener := range am.listeners {
+		if listener == ch {
+			am.listeners = append(am.listeners[:i], am.listeners[i+1:]...)
+			close(ch)
+			break
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package link
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mzyy94/gocarplay"
+	"github.com/mzyy94/gocarplay/protocol"
+	"github.com/mzyy94/gocarplay/store"
+)
+
+// AutoConnectPolicy decides which paired phone the dongle connects to
+type AutoConnectPolicy string
+
+const (
+	// PolicyPriority connects to the first phone in range from a priority-ordered list
+	PolicyPriority AutoConnectPolicy = "priority"
+	// PolicyLastUsed connects to the most recently used phone first
+	PolicyLastUsed AutoConnectPolicy = "last_used"
+	// PolicyAsk disables auto-connect until a phone is selected
+	PolicyAsk AutoConnectPolicy = "ask"
+)
+
+// ParseAutoConnectPolicy validates a policy name
+func ParseAutoConnectPolicy(name string) (AutoConnectPolicy, error) {
+	switch policy := AutoConnectPolicy(name); policy {
+	case PolicyPriority, PolicyLastUsed, PolicyAsk:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown auto-connect policy %q", name)
+}
+
+// Store keys for persisted auto-connect state
+const (
+	storeKeyPolicy   = "autoconnect.policy"
+	storeKeyPriority = "autoconnect.priority"
+	storeKeyLastUsed = "autoconnect.last_used"
+)
+
+// PhoneSelection is a snapshot of the auto-connect policy state
+type PhoneSelection struct {
+	Policy   AutoConnectPolicy `json:"policy"`
+	Priority []string          `json:"priority"`
+	LastUsed string            `json:"last_used"`
+	Pending  bool              `json:"pending"`  // A phone must be selected (policy "ask")
+	Enforced bool              `json:"enforced"` // The policy is applied, which needs paired list writes
+}
+
+// PhoneSelector enforces the auto-connect policy through the dongle's autoConn
+// setting, the AutoConnectEnable command and the paired list order, and
+// persists it across restarts. Choosing a phone needs paired list writes, so
+// without them the policy is kept but not enforced and changes are refused.
+type PhoneSelector struct {
+	mu        sync.Mutex
+	bluetooth *BluetoothManager
+	store     *store.Store
+	selection PhoneSelection
+	selected  string // Phone chosen for the current dongle session (policy "ask")
+	listeners []chan PhoneSelection
+}
+
+// NewPhoneSelector creates a phone selector from the configured policy.
+// Policy and history persisted in st take precedence over the configuration.
+func NewPhoneSelector(config gocarplay.AutoConnectConfig, bluetooth *BluetoothManager, st *store.Store) *PhoneSelector {
+	ps := &PhoneSelector{
+		bluetooth: bluetooth,
+		store:     st,
+		listeners: make([]chan PhoneSelection, 0),
+	}
+
+	policy, err := ParseAutoConnectPolicy(config.Policy)
+	if err != nil {
+		logger("autoconnect").Warnf("%v, using %s", err, PolicyLastUsed)
+		policy = PolicyLastUsed
+	}
+	ps.selection.Policy = policy
+	ps.selection.Priority = config.Priority
+
+	var stored string
+	if ok, err := st.Get(storeKeyPolicy, &stored); ok && err == nil {
+		if policy, err := ParseAutoConnectPolicy(stored); err == nil {
+			ps.selection.Policy = policy
+		}
+	}
+	st.Get(storeKeyPriority, &ps.selection.Priority)
+	st.Get(storeKeyLastUsed, &ps.selection.LastUsed)
+
+	logger("autoconnect").Infof("Policy: %s", ps.selection.Policy)
+	return ps
+}
+
+// GetSelection returns a snapshot of the policy state
+func (ps *PhoneSelector) GetSelection() PhoneSelection {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	selection := ps.selection
+	selection.Priority = append([]string(nil), ps.selection.Priority...)
+	selection.Enforced = ps.bluetooth.ReorderEnabled()
+	return selection
+}
+
+// Apply enforces the policy on a freshly configured dongle. Without paired list
+// writes the dongle keeps choosing phones by itself and ErrPairedListWriteDisabled is returned.
+func (ps *PhoneSelector) Apply() error {
+	ps.mu.Lock()
+	ps.selected = ""
+	policy := ps.selection.Policy
+	ps.mu.Unlock()
+
+	if !ps.bluetooth.ReorderEnabled() {
+		ps.update(func(selection *PhoneSelection) {
+			selection.Pending = false
+		})
+		if configuredAutoConn() {
+			if err := SendAutoConn(true); err != nil {
+				return err
+			}
+		}
+		if err := SendCommand(protocol.AutoConnectEnable); err != nil {
+			return err
+		}
+		logger("autoconnect").Warnf("Policy %s not enforced, the dongle chooses the phone: %v", policy, ErrPairedListWriteDisabled)
+		return ErrPairedListWriteDisabled
+	}
+
+	if policy == PolicyAsk {
+		ps.update(func(selection *PhoneSelection) {
+			selection.Pending = true
+		})
+		// Otherwise the dongle still connects any paired phone in range by itself
+		logger("autoconnect").Info("Waiting for phone selection, dongle auto-connect off")
+		return SendAutoConn(false)
+	}
+
+	ps.update(func(selection *PhoneSelection) {
+		selection.Pending = false
+	})
+	// Undo a previous "ask", the dongle may keep the setting across restarts
+	if configuredAutoConn() {
+		if err := SendAutoConn(true); err != nil {
+			return err
+		}
+	}
+	if err := ps.bluetooth.Prioritize(ps.Preferred()); err != nil {
+		return err
+	}
+	return SendCommand(protocol.AutoConnectEnable)
+}
+
+// configuredAutoConn returns the configured BoxSettings autoConn, true if unset
+func configuredAutoConn() bool {
+	config := currentConfig
+	return config == nil || config.AutoConn == nil || *config.AutoConn
+}
+
+// AutoConnectAllowed reports whether wireless connection attempts may start
+func (ps *PhoneSelector) AutoConnectAllowed() bool {
+	if !ps.bluetooth.ReorderEnabled() {
+		return true
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.selection.Policy != PolicyAsk || ps.selected != ""
+}
+
+// Preferred returns the phone addresses to try first, in order
+func (ps *PhoneSelector) Preferred() []string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.selected != "" {
+		return []string{ps.selected}
+	}
+	switch ps.selection.Policy {
+	case PolicyPriority:
+		return append([]string(nil), ps.selection.Priority...)
+	case PolicyLastUsed:
+		if ps.selection.LastUsed != "" {
+			return []string{ps.selection.LastUsed}
+		}
+	}
+	return nil
+}
+
+// SetPolicy changes and persists the policy, then enforces it.
+// It fails with ErrPairedListWriteDisabled, as the policy could not be enforced.
+func (ps *PhoneSelector) SetPolicy(policy AutoConnectPolicy, priority []string) error {
+	if policy == PolicyPriority && len(priority) == 0 {
+		return fmt.Errorf("policy %s requires a priority list", policy)
+	}
+	if !ps.bluetooth.ReorderEnabled() {
+		return ErrPairedListWriteDisabled
+	}
+
+	ps.update(func(selection *PhoneSelection) {
+		selection.Policy = policy
+		if priority != nil {
+			selection.Priority = priority
+		}
+	})
+
+	selection := ps.GetSelection()
+	if err := ps.store.Set(storeKeyPolicy, string(selection.Policy)); err != nil {
+		logger("autoconnect").Errorf("Failed to persist policy: %v", err)
+	}
+	if err := ps.store.Set(storeKeyPriority, selection.Priority); err != nil {
+		logger("autoconnect").Errorf("Failed to persist priority: %v", err)
+	}
+
+	logger("autoconnect").Infof("Policy changed to %s", policy)
+	if !IsConnected() {
+		return nil
+	}
+	return ps.Apply()
+}
+
+// Select connects to the given paired phone, e.g. after the rider picked it
+// while the "ask" policy is active. It fails with ErrPairedListWriteDisabled,
+// as the dongle would connect a phone of its own choice.
+func (ps *PhoneSelector) Select(address string) error {
+	if !ps.bluetooth.ReorderEnabled() {
+		return ErrPairedListWriteDisabled
+	}
+
+	found := false
+	for _, device := range ps.bluetooth.GetInfo().Paired {
+		if strings.EqualFold(device.Address, address) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("device %s not paired", address)
+	}
+
+	ps.mu.Lock()
+	ps.selected = address
+	ps.mu.Unlock()
+	ps.update(func(selection *PhoneSelection) {
+		selection.Pending = false
+	})
+
+	logger("autoconnect").Infof("Selected phone %s", address)
+	if err := ps.bluetooth.Prioritize([]string{address}); err != nil {
+		return err
+	}
+	return SendCommand(protocol.WifiConnect)
+}
+
+// RecordConnected remembers the phone as last used and persists it.
+// The address must come from the phone itself, e.g. its BoxSettings report.
+func (ps *PhoneSelector) RecordConnected(address string) {
+	if address == "" {
+		return
+	}
+
+	ps.update(func(selection *PhoneSelection) {
+		selection.LastUsed = address
+	})
+	if err := ps.store.Set(storeKeyLastUsed, address); err != nil {
+		logger("autoconnect").Errorf("Failed to persist last used phone: %v", err)
+	}
+}
+
+// update applies fn to the policy state and notifies listeners
+func (ps *PhoneSelector) update(fn func(selection *PhoneSelection)) {
+	ps.mu.Lock()
+	fn(&ps.selection)
+	listeners := ps.listeners
+	ps.mu.Unlock()
+
+	selection := ps.GetSelection()
+	for _, ch := range listeners {
+		select {
+		case ch <- selection:
+		default:
+			// Skip if channel is full
+		}
+	}
+}
+
+// Subscribe creates a new channel that will receive policy state notifications
+func (ps *PhoneSelector) Subscribe() chan PhoneSelection {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ch := make(chan PhoneSelection, 10)
+	ps.listeners = append(ps.listeners, ch)
+	return ch
+}
+
+// Unsubscribe removes a listener channel
+func (ps *PhoneSelector) Unsubscribe(ch chan PhoneSelection) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for i, listener := range ps.listeners {
+		if listener == ch {
+			ps.listeners = append(ps.listeners[:i], ps.listeners[i+1:]...)
+			close(ch)
+			break
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package link
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// ErrPairedListWriteDisabled is returned when changing the paired list requires
+// paired list writes, which are off unless enabled with SetReorderEnabled
+var ErrPairedListWriteDisabled = errors.New("Paired list writes disabled, enable pairedListReorder")
+
+// BluetoothInfo describes the dongle's Bluetooth identity and paired phones
+type BluetoothInfo struct {
+	Address   string                  `json:"address"`
+	Name      string                  `json:"name"`
+	PIN       string                  `json:"pin"`
+	Paired    []protocol.PairedDevice `json:"paired"`
+	PairedRaw string                  `json:"paired_raw"` // Paired list as reported, its format is undocumented
+}
+
+// BluetoothManager tracks the dongle's Bluetooth state and manages pairing
+type BluetoothManager struct {
+	mu        sync.RWMutex
+	info      BluetoothInfo
+	reorder   bool // Prioritize and Forget may rewrite the paired list
+	listeners []chan BluetoothInfo
+}
+
+// NewBluetoothManager creates a new Bluetooth manager
+func NewBluetoothManager() *BluetoothManager {
+	return &BluetoothManager{
+		listeners: make([]chan BluetoothInfo, 0),
+	}
+}
+
+// GetInfo returns a snapshot of the Bluetooth state
+func (bm *BluetoothManager) GetInfo() BluetoothInfo {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+
+	info := bm.info
+	info.Paired = append([]protocol.PairedDevice(nil), bm.info.Paired...)
+	return info
+}
+
+// Reset clears the Bluetooth state after the dongle is gone
+func (bm *BluetoothManager) Reset() {
+	bm.update(func(info *BluetoothInfo) {
+		*info = BluetoothInfo{}
+	})
+}
+
+// HandleMessage updates the Bluetooth state from a received dongle message.
+// It returns false if the message is not Bluetooth related.
+func (bm *BluetoothManager) HandleMessage(msg interface{}) bool {
+	switch msg := msg.(type) {
+	case *protocol.BluetoothAddress:
+		bm.update(func(info *BluetoothInfo) {
+			info.Address = trimNullTerm(msg.Address)
+		})
+	case *protocol.BluetoothDeviceName:
+		bm.update(func(info *BluetoothInfo) {
+			info.Name = trimNullTerm(msg.Data)
+		})
+	case *protocol.BluetoothPIN:
+		bm.update(func(info *BluetoothInfo) {
+			info.PIN = trimNullTerm(msg.Address)
+		})
+	case *protocol.BluetoothPairedList:
+		devices := msg.Devices()
+		bm.update(func(info *BluetoothInfo) {
+			info.Paired = devices
+			info.PairedRaw = trimNullTerm(msg.Data)
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+// StartPairing puts the dongle into Bluetooth pairing mode
+func (bm *BluetoothManager) StartPairing() error {
+	logger("bluetooth").Info("Starting pairing mode")
+	return SendCommand(protocol.BtPairStart)
+}
+
+// SetReorderEnabled allows Prioritize and Forget to rewrite the dongle's paired list.
+// Writing BluetoothPairedList is not verified on any firmware, so it is off by default.
+func (bm *BluetoothManager) SetReorderEnabled(enabled bool) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.reorder = enabled
+}
+
+// Forget removes a phone from the dongle's paired list. A connected phone is
+// disconnected first, as the dongle would otherwise keep the session.
+// It fails with ErrPairedListWriteDisabled unless enabled with SetReorderEnabled.
+func (bm *BluetoothManager) Forget(address string) error {
+	bm.mu.RLock()
+	paired := bm.info.Paired
+	reorder := bm.reorder
+	bm.mu.RUnlock()
+
+	remaining := make([]protocol.PairedDevice, 0, len(paired))
+	found := false
+	for _, device := range paired {
+		if strings.EqualFold(device.Address, address) {
+			found = true
+			continue
+		}
+		remaining = append(remaining, device)
+	}
+	if !found {
+		return errors.New("Device not paired")
+	}
+	if !reorder {
+		return ErrPairedListWriteDisabled
+	}
+
+	logger("bluetooth").Infof("Forgetting device %s", address)
+	if PhoneAttached() {
+		if err := DisconnectPhone(); err != nil {
+			return err
+		}
+	}
+	if err := SendData(protocol.NewBluetoothPairedList(remaining)); err != nil {
+		return err
+	}
+	bm.update(func(info *BluetoothInfo) {
+		info.Paired = remaining
+	})
+	return nil
+}
+
+// ReorderEnabled reports whether the paired list may be rewritten
+func (bm *BluetoothManager) ReorderEnabled() bool {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+	return bm.reorder
+}
+
+// Prioritize moves the given addresses to the front of the dongle's paired list,
+// in the given order, assuming the dongle tries paired phones in list order.
+// It fails with ErrPairedListWriteDisabled unless enabled with SetReorderEnabled.
+func (bm *BluetoothManager) Prioritize(addresses []string) error {
+	bm.mu.RLock()
+	paired := bm.info.Paired
+	reorder := bm.reorder
+	bm.mu.RUnlock()
+
+	if len(addresses) == 0 {
+		return nil
+	}
+	if !reorder {
+		return ErrPairedListWriteDisabled
+	}
+
+	ordered := make([]protocol.PairedDevice, 0, len(paired))
+	used := make([]bool, len(paired))
+	for _, address := range addresses {
+		for i, device := range paired {
+			if !used[i] && strings.EqualFold(device.Address, address) {
+				ordered = append(ordered, device)
+				used[i] = true
+			}
+		}
+	}
+	for i, device := range paired {
+		if !used[i] {
+			ordered = append(ordered, device)
+		}
+	}
+
+	if sameOrder(paired, ordered) {
+		return nil
+	}
+
+	logger("bluetooth").Infof("Reordering paired list, first: %s", ordered[0].Address)
+	if err := SendData(protocol.NewBluetoothPairedList(ordered)); err != nil {
+		return err
+	}
+	bm.update(func(info *BluetoothInfo) {
+		info.Paired = ordered
+	})
+	return nil
+}
+
+// sameOrder reports whether both lists contain the same devices in the same order
+func sameOrder(a, b []protocol.PairedDevice) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// update applies fn to the Bluetooth state and notifies listeners
+func (bm *BluetoothManager) update(fn func(info *BluetoothInfo)) {
+	bm.mu.Lock()
+	fn(&bm.info)
+	listeners := bm.listeners
+	bm.mu.Unlock()
+
+	info := bm.GetInfo()
+	for _, ch := range listeners {
+		select {
+		case ch <- info:
+		default:
+			// Skip if channel is full
+		}
+	}
+}
+
+// Subscribe creates a new channel that will receive Bluetooth state notifications
+func (bm *BluetoothManager) Subscribe() chan BluetoothInfo {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	ch := make(chan BluetoothInfo, 10)
+	bm.listeners = append(bm.listeners, ch)
+	return ch
+}
+
+// Unsubscribe removes a listener channel
+func (bm *BluetoothManager) Unsubscribe(ch chan BluetoothInfo) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	for i, listener := range bm.listeners {
+		if listener == ch {
+			bm.listeners = append(bm.listeners[:i], bm.listeners[i+1:]...)
+			close(ch)
+			break
+		}
+	}
+}
+
+// trimNullTerm returns the string without trailing null bytes
+func trimNullTerm(s protocol.NullTermString) string {
+	return strings.TrimRight(string(s), "\x00")
+}
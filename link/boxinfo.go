@@ -0,0 +1,69 @@
+package link
+
+import (
+	"sync"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// BoxSettingsInfo is the latest dongle and phone information reported in BoxSettings
+type BoxSettingsInfo struct {
+	Box   *protocol.BoxInfo   `json:"box,omitempty"`
+	Phone *protocol.PhoneInfo `json:"phone,omitempty"`
+}
+
+var boxInfo BoxSettingsInfo
+var boxInfoMutex sync.RWMutex
+
+// HandleBoxSettings records the settings reported by the dongle.
+// It returns false for other messages.
+func HandleBoxSettings(msg interface{}) bool {
+	settings, ok := msg.(*protocol.BoxSettings)
+	if !ok {
+		return false
+	}
+
+	report, err := settings.Report()
+	if err != nil {
+		logger("boxsettings").Infof("%v: %s", err, string(settings.Settings))
+		return true
+	}
+
+	boxInfoMutex.Lock()
+	if report.Box != nil {
+		boxInfo.Box = report.Box
+	}
+	if report.Phone != nil {
+		boxInfo.Phone = report.Phone
+	}
+	boxInfoMutex.Unlock()
+
+	if report.Box != nil {
+		logger("boxsettings").Infof("Dongle: %s %s (hw %s)", report.Box.OemName, report.Box.ProductType, report.Box.HwVersion)
+	}
+	if report.Phone != nil {
+		logger("boxsettings").Infof("Phone: %s %s via %s", report.Phone.Model, report.Phone.OSVersion, report.Phone.LinkType)
+	}
+	return true
+}
+
+// GetBoxSettingsInfo returns the latest dongle-reported settings
+func GetBoxSettingsInfo() BoxSettingsInfo {
+	boxInfoMutex.RLock()
+	defer boxInfoMutex.RUnlock()
+	return boxInfo
+}
+
+// ClearPhoneInfo forgets the reported phone info, e.g. after the phone is unplugged
+func ClearPhoneInfo() {
+	boxInfoMutex.Lock()
+	boxInfo.Phone = nil
+	boxInfoMutex.Unlock()
+}
+
+// resetBoxInfo forgets all reported settings after the connection is closed
+func resetBoxInfo() {
+	boxInfoMutex.Lock()
+	boxInfo = BoxSettingsInfo{}
+	boxInfoMutex.Unlock()
+}
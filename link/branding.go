@@ -0,0 +1,154 @@
+package link
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"sync"
+
+	"github.com/mzyy94/gocarplay"
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// OEMIconSize is the edge length of the uploaded OEM icon
+const OEMIconSize = 256
+
+// brandingIcons lists the icon files uploaded to the dongle and their edge length
+var brandingIcons = []struct {
+	Address protocol.FileAddress
+	Size    int
+}{
+	{protocol.FileAddressIcon120, 120},
+	{protocol.FileAddressIcon180, 180},
+	{protocol.FileAddressIcon256, 256},
+	{protocol.FileAddressOEMIcon, OEMIconSize},
+}
+
+// Resized icons are cached per source file, they are uploaded on every connect
+var iconCache struct {
+	sync.Mutex
+	path  string
+	files map[protocol.FileAddress][]byte
+}
+
+// sendBranding uploads the resized OEM icons, if an icon is configured,
+// and always the icon configuration as airplay.conf
+func sendBranding(config *gocarplay.DongleConfig) error {
+	branding := config.Branding
+	if branding.IconFile != "" {
+		files, err := loadBrandingIcons(branding.IconFile)
+		if err != nil {
+			return err
+		}
+		for _, icon := range brandingIcons {
+			err := SendData(&protocol.SendFile{
+				FileName: protocol.NullTermString(icon.Address + "\x00"),
+				Content:  files[icon.Address],
+			})
+			if err != nil {
+				return err
+			}
+		}
+		logger("branding").Infof("Uploaded icons from %s", branding.IconFile)
+	}
+
+	for key := range config.AirplayOptions {
+		if protocol.IsAirplayKey(key) {
+			logger("branding").Warnf("Ignoring airplayOptions.%s, set it through branding", key)
+		}
+	}
+	return SendIconConfig(config.AirplayConfig())
+}
+
+// loadBrandingIcons decodes the PNG at path and encodes it in all icon sizes
+func loadBrandingIcons(path string) (map[protocol.FileAddress][]byte, error) {
+	iconCache.Lock()
+	defer iconCache.Unlock()
+
+	if iconCache.path == path && iconCache.files != nil {
+		return iconCache.files, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	src, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid icon %s: %v", path, err)
+	}
+
+	files := make(map[protocol.FileAddress][]byte, len(brandingIcons))
+	for _, icon := range brandingIcons {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, resizeImage(src, icon.Size)); err != nil {
+			return nil, err
+		}
+		files[icon.Address] = buf.Bytes()
+	}
+
+	iconCache.path = path
+	iconCache.files = files
+	return files, nil
+}
+
+// resizeImage scales src to a size x size square using area averaging.
+// Non-square sources are centered on a transparent background.
+func resizeImage(src image.Image, size int) *image.NRGBA {
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	// Fit the longer edge, keeping the aspect ratio
+	srcW, srcH := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+	w, h := size, size
+	if srcW > srcH {
+		h = max(1, size*srcH/srcW)
+	} else if srcH > srcW {
+		w = max(1, size*srcW/srcH)
+	}
+	offX, offY := (size-w)/2, (size-h)/2
+
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*srcH/h, max((y+1)*srcH/h, y*srcH/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*srcW/w, max((x+1)*srcW/w, x*srcW/w+1)
+
+			// Average premultiplied samples of the covered source area
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					i := rgba.PixOffset(sx, sy)
+					r += uint32(rgba.Pix[i])
+					g += uint32(rgba.Pix[i+1])
+					b += uint32(rgba.Pix[i+2])
+					a += uint32(rgba.Pix[i+3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x+offX, y+offY)
+			if a == 0 {
+				continue
+			}
+			// Convert back to non-premultiplied alpha
+			dst.Pix[i] = uint8(r * 255 / a)
+			dst.Pix[i+1] = uint8(g * 255 / a)
+			dst.Pix[i+2] = uint8(b * 255 / a)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,327 @@
+package link
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// Call state timing
+const (
+	CallEndedHold = 2 * time.Second        // How long CallEnded is reported before returning to CallIdle
+	CallRingGrace = 500 * time.Millisecond // Wait for the microphone before reporting call audio as incoming
+)
+
+// CallState is the state of a phone call on the connected phone
+type CallState int
+
+const (
+	// CallIdle indicates no call is in progress
+	CallIdle CallState = iota
+	// CallIncoming indicates call audio started but the call is not answered yet
+	CallIncoming
+	// CallActive indicates the call is answered and the microphone is in use
+	CallActive
+	// CallEnded indicates the call just ended
+	CallEnded
+)
+
+// String returns the string representation of the call state
+func (s CallState) String() string {
+	switch s {
+	case CallIdle:
+		return "idle"
+	case CallIncoming:
+		return "incoming"
+	case CallActive:
+		return "active"
+	case CallEnded:
+		return "ended"
+	default:
+		return "unknown"
+	}
+}
+
+// CallDirection tells incoming from outgoing calls
+type CallDirection int
+
+const (
+	// CallDirectionUnknown is used without a call
+	CallDirectionUnknown CallDirection = iota
+	// CallDirectionIncoming indicates the call rang before the microphone opened
+	CallDirectionIncoming
+	// CallDirectionOutgoing indicates the microphone was open when call audio started
+	CallDirectionOutgoing
+)
+
+// String returns the string representation of the call direction
+func (d CallDirection) String() string {
+	switch d {
+	case CallDirectionIncoming:
+		return "incoming"
+	case CallDirectionOutgoing:
+		return "outgoing"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrNoCall is returned for call actions without a matching call
+var ErrNoCall = errors.New("No call in progress")
+
+// CallManager tracks the phone call state from call audio and microphone usage.
+// The dongle does not report calls directly: call audio starting while the phone
+// is not recording marks a call as incoming once CallRingGrace has passed, and the
+// phone recording from the microphone marks it as active. Call audio starting
+// while the microphone is open, or the microphone opening within CallRingGrace,
+// marks an outgoing or already active call.
+type CallManager struct {
+	mu        sync.Mutex
+	state     CallState
+	direction CallDirection
+	recording bool        // The phone is recording from the microphone
+	timer     *time.Timer // Returns from CallEnded to CallIdle
+	ringTimer *time.Timer // Reports CallIncoming after CallRingGrace
+	listeners []chan CallState
+}
+
+// NewCallManager creates a new call manager
+func NewCallManager() *CallManager {
+	return &CallManager{
+		listeners: make([]chan CallState, 0),
+	}
+}
+
+// GetState returns the current call state
+func (cm *CallManager) GetState() CallState {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.state
+}
+
+// GetDirection returns the direction of the current call
+func (cm *CallManager) GetDirection() CallDirection {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.direction
+}
+
+// HandleMessage updates the call state from call audio commands.
+// It returns false if the message is not call related.
+func (cm *CallManager) HandleMessage(msg interface{}) bool {
+	audio, ok := msg.(*protocol.AudioData)
+	if !ok {
+		return false
+	}
+
+	switch audio.Command {
+	case protocol.AudioPhonecallStart:
+		cm.callAudioStarted()
+	case protocol.AudioPhonecallStop:
+		cm.end()
+	default:
+		return false
+	}
+	return true
+}
+
+// callAudioStarted handles call audio starting, see CallManager
+func (cm *CallManager) callAudioStarted() {
+	cm.mu.Lock()
+	state := cm.state
+	recording := cm.recording
+	ringing := cm.ringTimer != nil
+	cm.mu.Unlock()
+
+	if state == CallIncoming || state == CallActive || ringing {
+		return
+	}
+	if recording {
+		cm.setCall(CallActive, CallDirectionOutgoing)
+		return
+	}
+
+	cm.mu.Lock()
+	var timer *time.Timer
+	timer = time.AfterFunc(CallRingGrace, func() {
+		cm.mu.Lock()
+		current := cm.ringTimer == timer // Not cancelled meanwhile
+		if current {
+			cm.ringTimer = nil
+		}
+		cm.mu.Unlock()
+		if current {
+			cm.setCall(CallIncoming, CallDirectionIncoming)
+		}
+	})
+	cm.ringTimer = timer
+	cm.mu.Unlock()
+}
+
+// HandleEvent updates the call state from a dispatched dongle event
+func (cm *CallManager) HandleEvent(event Event) {
+	mic, ok := event.(MicrophoneEvent)
+	if !ok {
+		return
+	}
+
+	cm.mu.Lock()
+	cm.recording = mic.Recording
+	state := cm.state
+	ringing := cm.stopRinging()
+	cm.mu.Unlock()
+
+	if !mic.Recording {
+		return
+	}
+	switch {
+	case ringing:
+		// The microphone opened right with the call audio: outgoing call
+		cm.setCall(CallActive, CallDirectionOutgoing)
+	case state == CallIncoming:
+		// The incoming call was answered
+		cm.setCall(CallActive, CallDirectionIncoming)
+	}
+}
+
+// stopRinging cancels a pending CallIncoming and reports whether one was pending.
+// The caller must hold cm.mu.
+func (cm *CallManager) stopRinging() bool {
+	if cm.ringTimer == nil {
+		return false
+	}
+	cm.ringTimer.Stop()
+	cm.ringTimer = nil
+	return true
+}
+
+// Accept answers the incoming call
+func (cm *CallManager) Accept() error {
+	if cm.GetState() != CallIncoming {
+		return ErrNoCall
+	}
+	logger("call").Info("Accepting call")
+	if err := SendPhoneCallAction(true); err != nil {
+		return err
+	}
+	cm.setCall(CallActive, CallDirectionIncoming)
+	return nil
+}
+
+// Reject declines the incoming call
+func (cm *CallManager) Reject() error {
+	if cm.GetState() != CallIncoming {
+		return ErrNoCall
+	}
+	logger("call").Info("Rejecting call")
+	if err := SendPhoneCallAction(false); err != nil {
+		return err
+	}
+	cm.end()
+	return nil
+}
+
+// HangUp asks the phone to end the active call. There is no known hang-up
+// command, so RejectPhoneCall is sent as a best effort; it is not verified to
+// end an active call on hardware. The state only changes once the call audio
+// stops, so a hang-up that has no effect leaves the call active.
+func (cm *CallManager) HangUp() error {
+	if cm.GetState() != CallActive {
+		return ErrNoCall
+	}
+	logger("call").Info("Hanging up (best effort)")
+	return SendPhoneCallAction(false)
+}
+
+// Reset returns to CallIdle, e.g. after the phone is unplugged
+func (cm *CallManager) Reset() {
+	cm.mu.Lock()
+	cm.recording = false
+	cm.stopRinging()
+	cm.mu.Unlock()
+	cm.setState(CallIdle)
+}
+
+// end reports CallEnded and returns to CallIdle after CallEndedHold
+func (cm *CallManager) end() {
+	cm.mu.Lock()
+	cm.stopRinging()
+	cm.mu.Unlock()
+
+	state := cm.GetState()
+	if state == CallIdle || state == CallEnded {
+		return
+	}
+	cm.setState(CallEnded)
+
+	cm.mu.Lock()
+	cm.timer = time.AfterFunc(CallEndedHold, func() {
+		if cm.GetState() == CallEnded {
+			cm.setState(CallIdle)
+		}
+	})
+	cm.mu.Unlock()
+}
+
+// setCall stores the call state with its direction and notifies listeners on change
+func (cm *CallManager) setCall(state CallState, direction CallDirection) {
+	cm.mu.Lock()
+	cm.direction = direction
+	cm.mu.Unlock()
+	cm.setState(state)
+}
+
+// setState stores the call state and notifies listeners on change.
+// The direction is kept until the call is over.
+func (cm *CallManager) setState(state CallState) {
+	cm.mu.Lock()
+	old := cm.state
+	cm.state = state
+	if state == CallIdle {
+		cm.direction = CallDirectionUnknown
+	}
+	if cm.timer != nil && state != CallEnded {
+		cm.timer.Stop()
+		cm.timer = nil
+	}
+	listeners := cm.listeners
+	cm.mu.Unlock()
+
+	if old == state {
+		return
+	}
+	logger("call").Infof("%v -> %v", old, state)
+	for _, ch := range listeners {
+		select {
+		case ch <- state:
+		default:
+			// Skip if channel is full
+		}
+	}
+}
+
+// Subscribe creates a new channel that will receive call state notifications
+func (cm *CallManager) Subscribe() chan CallState {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	ch := make(chan CallState, 10)
+	cm.listeners = append(cm.listeners, ch)
+	return ch
+}
+
+// Unsubscribe removes a listener channel
+func (cm *CallManager) Unsubscribe(ch chan CallState) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	for i, listener := range cm.listeners {
+		if listener == ch {
+			cm.listeners = append(cm.listeners[:i], cm.listeners[i+1:]...)
+			close(ch)
+			break
+		}
+	}
+}
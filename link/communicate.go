@@ -4,10 +4,9 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
-	"encoding/json"
 	"errors"
-	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/gousb"
@@ -26,6 +25,11 @@ var currentConfig *gocarplay.DongleConfig
 var writeMutex sync.Mutex     // Protects USB writes from concurrent access
 var connectionMutex sync.Mutex // Protects connection state changes
 var commDoneChan chan struct{} // Signals when communication loop exits
+var lastReceived int64         // UnixNano of the last message received from the dongle
+var phoneAttached int32        // 1 between Plugged and Unplugged
+
+// HeartbeatInterval is the interval at which heartbeats are sent to the dongle
+const HeartbeatInterval = 2 * time.Second
 
 func Init() error {
 	connectionMutex.Lock()
@@ -37,7 +41,7 @@ func Init() error {
 		return err
 	}
 	ctx, cancelCtx = context.WithCancel(context.Background())
-	log.Println("[Link] Initialization complete, ready to communicate")
+	logger("link").Info("Initialization complete, ready to communicate")
 	return nil
 }
 
@@ -56,7 +60,8 @@ func InitWithEndpoints(in *gousb.InEndpoint, out *gousb.OutEndpoint, cleanup fun
 	Done = cleanup
 	ctx, cancelCtx = context.WithCancel(context.Background())
 	commDoneChan = make(chan struct{})
-	log.Println("[Link] Initialization complete with provided endpoints")
+	markReceived()
+	logger("link").Info("Initialization complete with provided endpoints")
 	return nil
 }
 
@@ -82,7 +87,7 @@ func StartWithConfig(config *gocarplay.DongleConfig) error {
 	// Store config globally for phone detection
 	currentConfig = config
 
-	log.Printf("[Config] Starting with display: %dx%d @ %d fps, DPI: %d", config.Width, config.Height, config.Fps, config.Dpi)
+	logger("link").Infof("Starting with display: %dx%d @ %d fps, DPI: %d", config.Width, config.Height, config.Fps, config.Dpi)
 
 	// Send initial configuration files
 	err := SendData(&protocol.SendFile{
@@ -94,19 +99,11 @@ func StartWithConfig(config *gocarplay.DongleConfig) error {
 	}
 
 	// Send Open message
-	err = SendData(&protocol.Open{
-		Width:          config.Width,
-		Height:         config.Height,
-		VideoFrameRate: config.Fps,
-		Format:         config.Format,
-		PacketMax:      config.PacketMax,
-		IBoxVersion:    config.IBoxVersion,
-		PhoneWorkMode:  config.PhoneWorkMode,
-	})
+	err = sendOpen(config)
 	if err != nil {
 		return err
 	}
-	log.Println("[Config] Open message sent to dongle")
+	logger("link").Info("Open message sent to dongle")
 
 	// Send configuration settings
 	SendData(&protocol.SendFile{
@@ -129,21 +126,31 @@ func StartWithConfig(config *gocarplay.DongleConfig) error {
 		Content:  []byte(config.BoxName),
 	})
 
+	// Upload the OEM icon and names shown by the phone
+	if err := sendBranding(config); err != nil {
+		logger("branding").Errorf("Failed to send branding: %v", err)
+	}
+
 	// Send WiFi configuration
 	SendData(&protocol.CarPlay{Type: config.GetWifiCommand()})
 
 	// Send Box Settings
 	SendBoxSettings(config)
 
-	// Enable WiFi
-	SendData(&protocol.CarPlay{Type: protocol.SupportWifi})
+	// Enable WiFi; the WirelessManager initiates the connection
+	if config.WirelessEnabled {
+		SendData(&protocol.CarPlay{Type: protocol.SupportWifi})
+	}
 
 	// Configure microphone
 	SendData(&protocol.CarPlay{Type: config.GetMicCommand()})
 
 	// Configure audio transfer
 	audioCmd := config.GetAudioTransferCommand()
-	log.Printf("[Config] Setting audio transfer: %v", audioCmd)
+	if !FeatureEnabled(FeatureAudioTransfer) {
+		audioCmd = protocol.AudioTransferOff
+	}
+	logger("link").Infof("Setting audio transfer: %v", audioCmd)
 	SendData(&protocol.CarPlay{Type: audioCmd})
 
 	// Send Android work mode if configured
@@ -154,34 +161,81 @@ func StartWithConfig(config *gocarplay.DongleConfig) error {
 		})
 	}
 
-	// Delay before sending WiFi connect
-	time.Sleep(600 * time.Millisecond)
-	SendData(&protocol.CarPlay{Type: protocol.WifiConnect})
+	// Restore files written through the admin API before the reconnect
+	if err := ReapplyFiles(); err != nil {
+		logger("files").Errorf("Failed to re-apply files: %v", err)
+	}
 
 	// Start heartbeat
 	startHeartbeat()
 
-	log.Println("[Config] Configuration complete, dongle is ready")
+	logger("link").Info("Configuration complete, dongle is ready")
 	return nil
 }
 
+// sendOpen sends the Open handshake message for the given configuration
+func sendOpen(config *gocarplay.DongleConfig) error {
+	return SendData(&protocol.Open{
+		Width:          config.Width,
+		Height:         config.Height,
+		VideoFrameRate: config.Fps,
+		Format:         config.Format,
+		PacketMax:      config.PacketMax,
+		IBoxVersion:    config.IBoxVersion,
+		PhoneWorkMode:  config.PhoneWorkMode,
+	})
+}
+
+// ResendOpen repeats the Open handshake with the current configuration.
+// This is the first recovery step for a dongle that stopped responding.
+func ResendOpen() error {
+	config := currentConfig
+	if config == nil {
+		return errors.New("Not configured")
+	}
+	return sendOpen(config)
+}
+
 // SendBoxSettings sends the BoxSettings configuration message
 func SendBoxSettings(config *gocarplay.DongleConfig) error {
-	settings := map[string]interface{}{
-		"mediaDelay":       config.MediaDelay,
-		"syncTime":         time.Now().UnixMilli(),
-		"androidAutoSizeW": config.Width,
-		"androidAutoSizeH": config.Height,
-		"WiFiChannel":      config.GetWifiChannel(),
-		"wifiChannel":      config.GetWifiChannel(),
+	msg, err := protocol.NewBoxSettings(&protocol.BoxSettingsConfig{
+		MediaDelay:       config.MediaDelay,
+		SyncTime:         currentSyncTime(),
+		AndroidAutoSizeW: config.Width,
+		AndroidAutoSizeH: config.Height,
+		WiFiChannel:      config.GetWifiChannel(),
+		WifiChannel:      config.GetWifiChannel(),
+		MediaSound:       config.MediaSound,
+		CallQuality:      config.CallQuality,
+		AutoConn:         config.AutoConn,
+		NaviScreenInfo:   naviScreenInfo(config),
+	})
+	if err != nil {
+		return err
 	}
 
-	jsonData, err := json.Marshal(settings)
+	return SendData(msg)
+}
+
+// SendAutoConn turns the dongle's own auto-connect to known phones on or off
+func SendAutoConn(enabled bool) error {
+	msg, err := protocol.NewBoxSettingsUpdate(&protocol.BoxSettingsUpdate{AutoConn: &enabled})
 	if err != nil {
 		return err
 	}
+	return SendData(msg)
+}
 
-	return SendData(&protocol.BoxSettings{Settings: jsonData})
+// naviScreenInfo returns the navigation screen to request, nil if disabled
+func naviScreenInfo(config *gocarplay.DongleConfig) *protocol.NaviScreenInfo {
+	if !config.NaviScreen.Enabled || !FeatureEnabled(FeatureNaviVideo) {
+		return nil
+	}
+	return &protocol.NaviScreenInfo{
+		Width:  config.NaviScreen.Width,
+		Height: config.NaviScreen.Height,
+		Fps:    config.NaviScreen.Fps,
+	}
 }
 
 // Start initializes with default width, height, fps, dpi (backward compatibility)
@@ -198,7 +252,7 @@ func startHeartbeat() {
 	if heartbeatTicker != nil {
 		return
 	}
-	heartbeatTicker = time.NewTicker(2 * time.Second)
+	heartbeatTicker = time.NewTicker(HeartbeatInterval)
 	heartbeatDone = make(chan bool)
 
 	go func() {
@@ -238,7 +292,7 @@ func Communicate(onData func(interface{}), onError func(error)) error {
 		// Check if context is cancelled
 		select {
 		case <-ctx.Done():
-			log.Println("[Link] Communication loop cancelled")
+			logger("link").Info("Communication loop cancelled")
 			return ctx.Err()
 		default:
 			// Continue with normal operation
@@ -248,20 +302,45 @@ func Communicate(onData func(interface{}), onError func(error)) error {
 		if err != nil {
 			// Check if error is due to context cancellation
 			if ctx.Err() != nil {
-				log.Println("[Link] Communication stopped due to context cancellation")
+				logger("link").Info("Communication stopped due to context cancellation")
 				return ctx.Err()
 			}
 			onError(err)
 		} else {
+			markReceived()
+			switch received.(type) {
+			case *protocol.Plugged:
+				atomic.StoreInt32(&phoneAttached, 1)
+			case *protocol.Unplugged:
+				atomic.StoreInt32(&phoneAttached, 0)
+			}
 			onData(received)
 		}
 	}
 }
 
+// markReceived records the current time as the time of the last received message
+func markReceived() {
+	atomic.StoreInt64(&lastReceived, time.Now().UnixNano())
+}
+
+// PhoneAttached reports whether the dongle reported a phone as plugged
+func PhoneAttached() bool {
+	return atomic.LoadInt32(&phoneAttached) == 1
+}
+
+// LastReceived returns the time the last message was received from the dongle
+func LastReceived() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&lastReceived))
+}
+
 func SendData(data interface{}) error {
 	if epOut == nil {
 		return errors.New("Not connected")
 	}
+	if err := checkInputPolicy(data); err != nil {
+		return err
+	}
 	return SendMessage(epOut, data)
 }
 
@@ -270,7 +349,9 @@ func Close() {
 	connectionMutex.Lock()
 	defer connectionMutex.Unlock()
 
-	log.Println("[Link] Closing connection gracefully...")
+	atomic.StoreInt32(&phoneAttached, 0)
+
+	logger("link").Info("Closing connection gracefully...")
 
 	// Cancel context to stop communication loop
 	if cancelCtx != nil {
@@ -280,12 +361,12 @@ func Close() {
 
 	// Wait for communication loop to exit with timeout
 	if commDoneChan != nil {
-		log.Println("[Link] Waiting for communication loop to exit...")
+		logger("link").Info("Waiting for communication loop to exit...")
 		select {
 		case <-commDoneChan:
-			log.Println("[Link] Communication loop exited cleanly")
+			logger("link").Info("Communication loop exited cleanly")
 		case <-time.After(500 * time.Millisecond):
-			log.Println("[Link] WARNING: Communication loop exit timeout, proceeding with cleanup")
+			logger("link").Warn("Communication loop exit timeout, proceeding with cleanup")
 		}
 		commDoneChan = nil
 	}
@@ -295,7 +376,7 @@ func Close() {
 
 	// Close USB connection
 	if Done != nil {
-		log.Println("[Link] Closing USB resources...")
+		logger("link").Info("Closing USB resources...")
 		Done()
 		Done = nil
 	}
@@ -304,8 +385,10 @@ func Close() {
 	epIn = nil
 	epOut = nil
 	currentConfig = nil
+	resetDongleInfo()
+	resetBoxInfo()
 
-	log.Println("[Link] Connection closed")
+	logger("link").Info("Connection closed")
 }
 
 // IsConnected returns true if the link is currently connected
@@ -357,7 +440,7 @@ func HandlePhonePlugged(plugged *protocol.Plugged) {
 		if err == nil {
 			currentConfig.AndroidWorkMode = true
 			// Log the auto-enable action (you can pass this to a callback if needed)
-			println("Auto-enabled Android work mode for", plugged.PhoneType.String())
+			logger("link").Infof("Auto-enabled Android work mode for %v", plugged.PhoneType)
 		}
 	}
 }
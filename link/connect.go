@@ -2,19 +2,61 @@ package link
 
 import (
 	"errors"
-	"log"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/google/gousb"
+	"github.com/mzyy94/gocarplay"
 )
 
-// KnownDevices contains the list of known CarPlay dongle USB device IDs
-var KnownDevices = []struct {
-	VendorID  uint16
-	ProductID uint16
-}{
-	{VendorID: 0x1314, ProductID: 0x1520},
-	{VendorID: 0x1314, ProductID: 0x1521},
+// KnownDevices contains the list of known CarPlay dongle USB devices and their quirks.
+// Use RegisterDevices to extend or override it from configuration.
+//
+// Only IDs with a public source are listed: these two are the whole known
+// device list of the node-CarPlay and pi-carplay DongleDriver. No further
+// Carlinkit/AutoKit IDs could be sourced yet, so other revisions must be added
+// through usbDevices or USB_DEVICES until they are confirmed.
+var KnownDevices = []gocarplay.USBDeviceConfig{
+	{VendorID: 0x1314, ProductID: 0x1520, Name: "Carlinkit"},
+	{VendorID: 0x1314, ProductID: 0x1521, Name: "Carlinkit"},
+}
+
+var devicesMutex sync.RWMutex // Protects KnownDevices
+
+var usbDevice *gousb.Device   // Currently opened dongle, used for port resets
+var usbDeviceMutex sync.Mutex // Protects usbDevice
+
+// RegisterDevices adds dongle descriptors to KnownDevices.
+// An entry with the same VendorID/ProductID as a known device replaces it.
+func RegisterDevices(devices []gocarplay.USBDeviceConfig) {
+	devicesMutex.Lock()
+	defer devicesMutex.Unlock()
+
+	for _, device := range devices {
+		replaced := false
+		for i, known := range KnownDevices {
+			if known.VendorID == device.VendorID && known.ProductID == device.ProductID {
+				KnownDevices[i] = device
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			KnownDevices = append(KnownDevices, device)
+		}
+		logger("usb").Infof("Registered device %v", device)
+	}
+}
+
+// knownDevices returns a snapshot of KnownDevices
+func knownDevices() []gocarplay.USBDeviceConfig {
+	devicesMutex.RLock()
+	defer devicesMutex.RUnlock()
+
+	devices := make([]gocarplay.USBDeviceConfig, len(KnownDevices))
+	copy(devices, KnownDevices)
+	return devices
 }
 
 func Connect() (*gousb.InEndpoint, *gousb.OutEndpoint, func(), error) {
@@ -36,25 +78,27 @@ func ConnectWithTimeout(maxRetries int, retryDelay time.Duration) (*gousb.InEndp
 		}
 	}()
 
-	log.Println("[USB] Searching for CarPlay dongle...")
+	logger("usb").Info("Searching for CarPlay dongle...")
 	ctx := gousb.NewContext()
 	cleanTask = append(cleanTask, func() { ctx.Close() })
 
 	var (
 		dev       *gousb.Device
+		desc      gocarplay.USBDeviceConfig
 		err       error
 		waitCount = maxRetries
 	)
 
 	for {
 		// Try each known device
-		for _, device := range KnownDevices {
+		for _, device := range knownDevices() {
 			dev, err = ctx.OpenDeviceWithVIDPID(gousb.ID(device.VendorID), gousb.ID(device.ProductID))
 			if err != nil {
 				continue // Try next device
 			}
 			if dev != nil {
-				log.Printf("[USB] Found device: VendorID=0x%04x, ProductID=0x%04x", device.VendorID, device.ProductID)
+				logger("usb").Infof("Found device: VendorID=0x%04x, ProductID=0x%04x", device.VendorID, device.ProductID)
+				desc = device
 				cleanTask = append(cleanTask, func() { dev.Close() })
 				goto deviceFound
 			}
@@ -63,46 +107,56 @@ func ConnectWithTimeout(maxRetries int, retryDelay time.Duration) (*gousb.InEndp
 		// No device found, retry or fail
 		waitCount--
 		if waitCount < 0 {
-			log.Println("[USB] ERROR: Could not find a compatible CarPlay dongle device")
+			logger("usb").Error("Could not find a compatible CarPlay dongle device")
 			return nil, nil, nil, errors.New("Could not find a compatible CarPlay dongle device")
 		}
-		log.Printf("[USB] Device not found, retrying... (%d attempts remaining)", waitCount)
+		logger("usb").Infof("Device not found, retrying... (%d attempts remaining)", waitCount)
 		time.Sleep(retryDelay)
 	}
 
 deviceFound:
 
-	intf, done, err := dev.DefaultInterface()
+	intf, done, err := claimInterface(dev, desc)
 	if err != nil {
-		log.Printf("[USB] ERROR: Failed to claim interface: %v", err)
+		logger("usb").Errorf("Failed to claim interface: %v", err)
 		return nil, nil, nil, err
 	}
 	cleanTask = append(cleanTask, done)
 
-	epOut, err := intf.OutEndpoint(1)
+	epOut, err := intf.OutEndpoint(desc.OutEndpointNumber())
 	if err != nil {
-		log.Printf("[USB] ERROR: Failed to open OUT endpoint: %v", err)
+		logger("usb").Errorf("Failed to open OUT endpoint: %v", err)
 		return nil, nil, nil, err
 	}
-	epIn, err := intf.InEndpoint(1)
+	epIn, err := intf.InEndpoint(desc.InEndpointNumber())
 	if err != nil {
-		log.Printf("[USB] ERROR: Failed to open IN endpoint: %v", err)
+		logger("usb").Errorf("Failed to open IN endpoint: %v", err)
 		return nil, nil, nil, err
 	}
 
-	log.Println("[USB] Successfully connected to CarPlay dongle")
-	log.Printf("[USB] Endpoints configured: IN=0x%02x, OUT=0x%02x", epIn.Desc.Address, epOut.Desc.Address)
+	logger("usb").Info("Successfully connected to CarPlay dongle")
+	logger("usb").Infof("Endpoints configured: IN=0x%02x, OUT=0x%02x", epIn.Desc.Address, epOut.Desc.Address)
 
 	closeTask := make([]func(), len(cleanTask))
 	copy(closeTask, cleanTask)
 	cleanTask = nil
 
+	usbDeviceMutex.Lock()
+	usbDevice = dev
+	usbDeviceMutex.Unlock()
+
 	return epIn, epOut, func() {
+		usbDeviceMutex.Lock()
+		if usbDevice == dev {
+			usbDevice = nil
+		}
+		usbDeviceMutex.Unlock()
+
 		// Wrap cleanup in recovery to prevent crashes from libusb errors
 		// This is critical when device is physically disconnected
 		defer func() {
 			if r := recover(); r != nil {
-				log.Printf("[USB] PANIC during cleanup (recovered): %v", r)
+				logger("usb").Errorf("PANIC during cleanup (recovered): %v", r)
 			}
 		}()
 
@@ -110,12 +164,54 @@ deviceFound:
 			func() {
 				defer func() {
 					if r := recover(); r != nil {
-						log.Printf("[USB] PANIC during cleanup task %d (recovered): %v", i, r)
+						logger("usb").Errorf("PANIC during cleanup task %d (recovered): %v", i, r)
 					}
 				}()
 				task()
 			}()
 		}
-		log.Println("[USB] Cleanup complete")
+		logger("usb").Info("Cleanup complete")
+	}, nil
+}
+
+// claimInterface claims the interface described by desc on the active configuration
+func claimInterface(dev *gousb.Device, desc gocarplay.USBDeviceConfig) (*gousb.Interface, func(), error) {
+	if desc.DetachKernelDriver {
+		if err := dev.SetAutoDetach(true); err != nil {
+			logger("usb").Warnf("Failed to enable kernel driver auto-detach: %v", err)
+		}
+	}
+
+	cfgNum, err := dev.ActiveConfigNum()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get active config number: %v", err)
+	}
+	cfg, err := dev.Config(cfgNum)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to claim config %d: %v", cfgNum, err)
+	}
+	intf, err := cfg.Interface(desc.Interface, desc.AltSetting)
+	if err != nil {
+		cfg.Close()
+		return nil, nil, fmt.Errorf("failed to select interface #%d alternate setting %d: %v", desc.Interface, desc.AltSetting, err)
+	}
+	logger("usb").Infof("Claimed interface #%d (alt %d) of config %d", desc.Interface, desc.AltSetting, cfgNum)
+
+	return intf, func() {
+		intf.Close()
+		cfg.Close()
 	}, nil
 }
+
+// ResetDevice performs a USB port reset of the currently opened dongle.
+// The device re-enumerates, so open endpoints may become unusable afterwards.
+func ResetDevice() error {
+	usbDeviceMutex.Lock()
+	defer usbDeviceMutex.Unlock()
+
+	if usbDevice == nil {
+		return errors.New("No device opened")
+	}
+	logger("usb").Info("Resetting dongle USB port...")
+	return usbDevice.Reset()
+}
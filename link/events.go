@@ -0,0 +1,169 @@
+package link
+
+import (
+	"sync"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// Event is a typed event decoded from a dongle-originated CarPlay command
+type Event interface {
+	// Name returns a short identifier of the event for logging and publishing
+	Name() string
+}
+
+// BluetoothEvent reports the dongle's Bluetooth link to the phone
+type BluetoothEvent struct {
+	Connected bool
+}
+
+// Name implements Event
+func (e BluetoothEvent) Name() string { return "bluetooth" }
+
+// WifiEvent reports the dongle's WiFi link to the phone
+type WifiEvent struct {
+	Connected bool
+}
+
+// Name implements Event
+func (e WifiEvent) Name() string { return "wifi" }
+
+// DeviceSearchStatus is the progress of the dongle's search for a wireless phone
+type DeviceSearchStatus int
+
+const (
+	// SearchScanning indicates the dongle is scanning for phones
+	SearchScanning DeviceSearchStatus = iota
+	// SearchDeviceFound indicates a known phone was found
+	SearchDeviceFound
+	// SearchDeviceNotFound indicates no known phone was found
+	SearchDeviceNotFound
+	// SearchConnectFailed indicates connecting to the found phone failed
+	SearchConnectFailed
+)
+
+// String returns the string representation of the search status
+func (s DeviceSearchStatus) String() string {
+	switch s {
+	case SearchScanning:
+		return "scanning"
+	case SearchDeviceFound:
+		return "found"
+	case SearchDeviceNotFound:
+		return "not_found"
+	case SearchConnectFailed:
+		return "connect_failed"
+	default:
+		return "unknown"
+	}
+}
+
+// DeviceSearchEvent reports progress of the dongle's search for a wireless phone
+type DeviceSearchEvent struct {
+	Status DeviceSearchStatus
+}
+
+// Name implements Event
+func (e DeviceSearchEvent) Name() string { return "device_search" }
+
+// HostUIRequestEvent is sent when the phone asks to return to the native (host) UI
+type HostUIRequestEvent struct{}
+
+// Name implements Event
+func (e HostUIRequestEvent) Name() string { return "host_ui_request" }
+
+// MicrophoneEvent reports that the phone starts or stops recording from the host microphone
+type MicrophoneEvent struct {
+	Recording bool
+}
+
+// Name implements Event
+func (e MicrophoneEvent) Name() string { return "microphone" }
+
+// commandEvent maps a dongle-originated command to its typed event
+func commandEvent(command protocol.CarPlayType) (Event, bool) {
+	switch command {
+	case protocol.BtConnected:
+		return BluetoothEvent{Connected: true}, true
+	case protocol.BtDisconnected:
+		return BluetoothEvent{Connected: false}, true
+	case protocol.WifiConnected:
+		return WifiEvent{Connected: true}, true
+	case protocol.WifiDisconnected:
+		return WifiEvent{Connected: false}, true
+	case protocol.ScanningDevice:
+		return DeviceSearchEvent{Status: SearchScanning}, true
+	case protocol.DeviceFound:
+		return DeviceSearchEvent{Status: SearchDeviceFound}, true
+	case protocol.DeviceNotFound:
+		return DeviceSearchEvent{Status: SearchDeviceNotFound}, true
+	case protocol.ConnectDeviceFailed:
+		return DeviceSearchEvent{Status: SearchConnectFailed}, true
+	case protocol.RequestHostUI:
+		return HostUIRequestEvent{}, true
+	case protocol.StartRecordAudio:
+		return MicrophoneEvent{Recording: true}, true
+	case protocol.StopRecordAudio:
+		return MicrophoneEvent{Recording: false}, true
+	}
+	return nil, false
+}
+
+// EventDispatcher routes dongle-originated CarPlay commands to typed events
+type EventDispatcher struct {
+	mu        sync.RWMutex
+	listeners []chan Event
+}
+
+// NewEventDispatcher creates a new event dispatcher
+func NewEventDispatcher() *EventDispatcher {
+	return &EventDispatcher{
+		listeners: make([]chan Event, 0),
+	}
+}
+
+// Dispatch converts the command to a typed event and notifies all listeners.
+// It returns false if the command has no event mapping.
+func (ed *EventDispatcher) Dispatch(msg *protocol.CarPlay) bool {
+	event, ok := commandEvent(msg.Type)
+	if !ok {
+		return false
+	}
+
+	ed.mu.RLock()
+	listeners := ed.listeners
+	ed.mu.RUnlock()
+
+	for _, ch := range listeners {
+		select {
+		case ch <- event:
+		default:
+			logger("events").Warnf("Listener full, dropped %s event", event.Name())
+		}
+	}
+	return true
+}
+
+// Subscribe creates a new channel that will receive dispatched events
+func (ed *EventDispatcher) Subscribe() chan Event {
+	ed.mu.Lock()
+	defer ed.mu.Unlock()
+
+	ch := make(chan Event, 10)
+	ed.listeners = append(ed.listeners, ch)
+	return ch
+}
+
+// Unsubscribe removes a listener channel
+func (ed *EventDispatcher) Unsubscribe(ch chan Event) {
+	ed.mu.Lock()
+	defer ed.mu.Unlock()
+
+	for i, listener := range ed.listeners {
+		if listener == ch {
+			ed.listeners = append(ed.listeners[:i], ed.listeners[i+1:]...)
+			close(ch)
+			break
+		}
+	}
+}
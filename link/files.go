@@ -0,0 +1,168 @@
+package link
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// FileValueType is the encoding of a value written to a dongle file
+type FileValueType string
+
+const (
+	// FileValueString writes the value as raw text
+	FileValueString FileValueType = "string"
+	// FileValueInt writes the value as a little-endian int32
+	FileValueInt FileValueType = "int"
+	// FileValueBool writes the value as a little-endian int32 0 or 1
+	FileValueBool FileValueType = "bool"
+	// FileValueBase64 writes the base64-decoded value
+	FileValueBase64 FileValueType = "base64"
+)
+
+// ErrFileNotAllowed is returned for dongle paths missing from AllowedFiles
+var ErrFileNotAllowed = errors.New("File not in allow-list")
+
+// AllowedFiles lists the dongle paths that may be written through SendDongleFile.
+// Use AllowFiles to extend it from configuration.
+var AllowedFiles = []protocol.FileAddress{
+	protocol.FileAddressDPI,
+	protocol.FileAddressNightMode,
+	protocol.FileAddressHandDriveMode,
+	protocol.FileAddressChargeMode,
+	protocol.FileAddressBoxName,
+	protocol.FileAddressOEMIcon,
+	protocol.FileAddressAirplayConfig,
+	protocol.FileAddressIcon120,
+	protocol.FileAddressIcon180,
+	protocol.FileAddressIcon256,
+	protocol.FileAddressAndroidWorkMode,
+}
+
+// SentFile records a file written to the dongle through SendDongleFile
+type SentFile struct {
+	Path    string        `json:"path"`
+	Type    FileValueType `json:"type"`
+	Value   string        `json:"value"`
+	Size    int           `json:"size"`
+	SentAt  time.Time     `json:"sent_at"`
+	content []byte
+}
+
+var sentFiles []SentFile
+var filesMutex sync.Mutex // Protects AllowedFiles and sentFiles
+
+// AllowFiles adds dongle paths to AllowedFiles
+func AllowFiles(paths []string) {
+	filesMutex.Lock()
+	defer filesMutex.Unlock()
+	for _, path := range paths {
+		AllowedFiles = append(AllowedFiles, protocol.FileAddress(path))
+	}
+}
+
+// EncodeFileValue converts a textual value to the file content for the given type
+func EncodeFileValue(valueType FileValueType, value string) ([]byte, error) {
+	switch valueType {
+	case FileValueString, "":
+		return []byte(value), nil
+	case FileValueInt:
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int value: %s", value)
+		}
+		return intToByte(int32(n)), nil
+	case FileValueBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool value: %s", value)
+		}
+		return boolToByte(b), nil
+	case FileValueBase64:
+		return base64.StdEncoding.DecodeString(value)
+	default:
+		return nil, fmt.Errorf("unknown value type: %s", valueType)
+	}
+}
+
+// SendDongleFile writes a typed value to an allow-listed dongle path and
+// records it so ReapplyFiles can restore it after a reconnect
+func SendDongleFile(path string, valueType FileValueType, value string) error {
+	if !fileAllowed(path) {
+		return ErrFileNotAllowed
+	}
+	if valueType == "" {
+		valueType = FileValueString
+	}
+	content, err := EncodeFileValue(valueType, value)
+	if err != nil {
+		return err
+	}
+
+	logger("files").Infof("Writing %s (%s, %d bytes)", path, valueType, len(content))
+	if err := sendFile(path, content); err != nil {
+		return err
+	}
+
+	file := SentFile{
+		Path:    path,
+		Type:    valueType,
+		Value:   value,
+		Size:    len(content),
+		SentAt:  time.Now(),
+		content: content,
+	}
+
+	filesMutex.Lock()
+	defer filesMutex.Unlock()
+	for i := range sentFiles {
+		if sentFiles[i].Path == path {
+			sentFiles[i] = file
+			return nil
+		}
+	}
+	sentFiles = append(sentFiles, file)
+	return nil
+}
+
+// SentFiles returns the files last written through SendDongleFile
+func SentFiles() []SentFile {
+	filesMutex.Lock()
+	defer filesMutex.Unlock()
+	return append([]SentFile(nil), sentFiles...)
+}
+
+// ReapplyFiles writes all recorded files again, e.g. after a dongle reconnect
+func ReapplyFiles() error {
+	for _, file := range SentFiles() {
+		logger("files").Infof("Re-applying %s", file.Path)
+		if err := sendFile(file.Path, file.content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fileAllowed(path string) bool {
+	filesMutex.Lock()
+	defer filesMutex.Unlock()
+	for _, allowed := range AllowedFiles {
+		if string(allowed) == path {
+			return true
+		}
+	}
+	return false
+}
+
+func sendFile(path string, content []byte) error {
+	return SendData(&protocol.SendFile{
+		FileName: protocol.NullTermString(path + "\x00"),
+		Content:  content,
+	})
+}
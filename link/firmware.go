@@ -0,0 +1,166 @@
+package link
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mzyy94/gocarplay"
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// Features that can be disabled per firmware version
+const (
+	FeatureMultiTouch    = "multi_touch"
+	FeatureAudioTransfer = "audio_transfer"
+	FeatureGNSS          = "gnss"
+	FeatureVehicleInfo   = "vehicle_info"
+	FeatureNaviVideo     = "navi_video"
+)
+
+// ErrFeatureDisabled is returned when the dongle firmware does not support a feature
+var ErrFeatureDisabled = errors.New("Feature disabled for this dongle firmware")
+
+// CompatibilityTable lists feature restrictions by firmware version.
+// Firmware versions are date based, e.g. "2021.03.25.1208".
+// Use AddCompatibilityRules to extend it from configuration.
+//
+// No known-bad builds are confirmed yet, so nothing is restricted by default;
+// only add rules that cite a build shown to misbehave.
+var CompatibilityTable = []gocarplay.CompatibilityRule{}
+
+// DongleInfo describes the connected dongle's firmware and manufacturer
+type DongleInfo struct {
+	SoftwareVersion  string   `json:"software_version"`
+	ManufacturerA    int32    `json:"manufacturer_a"`
+	ManufacturerB    int32    `json:"manufacturer_b"`
+	DisabledFeatures []string `json:"disabled_features"`
+	Warnings         []string `json:"warnings"`
+}
+
+var dongleInfo DongleInfo
+var dongleInfoMutex sync.RWMutex // Protects dongleInfo and CompatibilityTable
+
+// AddCompatibilityRules appends rules to CompatibilityTable
+func AddCompatibilityRules(rules []gocarplay.CompatibilityRule) {
+	dongleInfoMutex.Lock()
+	defer dongleInfoMutex.Unlock()
+	CompatibilityTable = append(CompatibilityTable, rules...)
+}
+
+// GetDongleInfo returns the firmware and manufacturer info of the connected dongle
+func GetDongleInfo() DongleInfo {
+	dongleInfoMutex.RLock()
+	defer dongleInfoMutex.RUnlock()
+
+	info := dongleInfo
+	info.DisabledFeatures = append([]string(nil), dongleInfo.DisabledFeatures...)
+	info.Warnings = append([]string(nil), dongleInfo.Warnings...)
+	return info
+}
+
+// HandleDongleInfo records SoftwareVersion and ManufacturerInfo messages.
+// It returns false for other messages.
+func HandleDongleInfo(msg interface{}) bool {
+	switch msg := msg.(type) {
+	case *protocol.SoftwareVersion:
+		version := trimNullTerm(msg.Version)
+		logger("firmware").Infof("Dongle software version: %s", version)
+		applyCompatibility(version)
+	case *protocol.ManufacturerInfo:
+		logger("firmware").Infof("Manufacturer info: %d/%d", msg.A, msg.B)
+		dongleInfoMutex.Lock()
+		dongleInfo.ManufacturerA = msg.A
+		dongleInfo.ManufacturerB = msg.B
+		dongleInfoMutex.Unlock()
+	default:
+		return false
+	}
+	return true
+}
+
+// FeatureEnabled reports whether the connected dongle's firmware supports the feature
+func FeatureEnabled(feature string) bool {
+	dongleInfoMutex.RLock()
+	defer dongleInfoMutex.RUnlock()
+
+	for _, disabled := range dongleInfo.DisabledFeatures {
+		if disabled == feature {
+			return false
+		}
+	}
+	return true
+}
+
+// resetDongleInfo forgets the dongle info after the connection is closed
+func resetDongleInfo() {
+	dongleInfoMutex.Lock()
+	dongleInfo = DongleInfo{}
+	dongleInfoMutex.Unlock()
+}
+
+// applyCompatibility evaluates CompatibilityTable for the firmware version
+func applyCompatibility(version string) {
+	dongleInfoMutex.Lock()
+	dongleInfo.SoftwareVersion = version
+	dongleInfo.DisabledFeatures = nil
+	dongleInfo.Warnings = nil
+	for _, rule := range CompatibilityTable {
+		if rule.MinVersion != "" && compareVersions(version, rule.MinVersion) < 0 {
+			continue
+		}
+		if rule.MaxVersion != "" && compareVersions(version, rule.MaxVersion) > 0 {
+			continue
+		}
+		dongleInfo.DisabledFeatures = append(dongleInfo.DisabledFeatures, rule.Disable...)
+		if rule.Warning != "" {
+			dongleInfo.Warnings = append(dongleInfo.Warnings, rule.Warning)
+		}
+	}
+	info := dongleInfo
+	dongleInfoMutex.Unlock()
+
+	for _, warning := range info.Warnings {
+		logger("firmware").Warnf("%s (version %s)", warning, version)
+	}
+	if len(info.DisabledFeatures) > 0 {
+		logger("firmware").Infof("Disabled features: %v", info.DisabledFeatures)
+	}
+
+	// Audio transfer is configured before the version is known; revert it if unsupported
+	config := currentConfig
+	if config != nil && config.AudioTransferMode && !FeatureEnabled(FeatureAudioTransfer) {
+		logger("firmware").Warn("Audio transfer unsupported, switching it off")
+		SendCommand(protocol.AudioTransferOff)
+	}
+}
+
+// compareVersions compares a firmware version with a rule bound, component by
+// component. Only as many components as the bound has are compared, so that
+// "2020.12.31.1208" matches the bound "2020.12.31".
+func compareVersions(version, bound string) int {
+	split := func(v string) []string {
+		return strings.FieldsFunc(v, func(r rune) bool { return r < '0' || r > '9' })
+	}
+	pa, pb := split(version), split(bound)
+	if len(pa) > len(pb) {
+		pa = pa[:len(pb)]
+	}
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,30 @@
+package link
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		bound   string
+		want    int
+	}{
+		{name: "equal", version: "2021.03.06.1355", bound: "2021.03.06.1355", want: 0},
+		{name: "date-only bound matches the whole day", version: "2020.12.31.1208", bound: "2020.12.31", want: 0},
+		{name: "older day", version: "2020.12.30.2359", bound: "2020.12.31", want: -1},
+		{name: "newer day", version: "2021.01.01.0001", bound: "2020.12.31", want: 1},
+		{name: "older build", version: "2021.03.06.1300", bound: "2021.03.06.1355", want: -1},
+		{name: "newer build", version: "2021.03.06.1400", bound: "2021.03.06.1355", want: 1},
+		{name: "shorter version is padded with zeros", version: "2021.03", bound: "2021.03.06", want: -1},
+		{name: "numeric not lexical", version: "2021.10.01", bound: "2021.9.30", want: 1},
+		{name: "separators are ignored", version: "2021-03-06_1355", bound: "2021.03.06", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareVersions(tt.version, tt.bound); got != tt.want {
+				t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.version, tt.bound, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package link
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// DefaultGNSSInterval is the minimum time between GNSS messages sent to the phone
+const DefaultGNSSInterval = time.Second
+
+// knotsPerKmh converts km/h to the knots used by NMEA
+const knotsPerKmh = 0.539957
+
+// Position is a GNSS fix
+type Position struct {
+	Time       time.Time
+	Latitude   float64 // Degrees, negative is south
+	Longitude  float64 // Degrees, negative is west
+	Altitude   float64 // Meters above mean sea level
+	Speed      float64 // km/h
+	Course     float64 // Degrees from true north
+	Satellites int
+	Valid      bool
+}
+
+// Sentences formats the fix as NMEA RMC and GGA sentences
+func (p Position) Sentences() []string {
+	t := p.Time.UTC()
+	clock := t.Format("150405") + fmt.Sprintf(".%02d", t.Nanosecond()/1e7)
+	lat, latHemisphere := nmeaCoordinate(p.Latitude, 2, "N", "S")
+	lon, lonHemisphere := nmeaCoordinate(p.Longitude, 3, "E", "W")
+
+	status, quality := "V", 0
+	if p.Valid {
+		status, quality = "A", 1
+	}
+
+	rmc := fmt.Sprintf("GPRMC,%s,%s,%s,%s,%s,%s,%.1f,%.1f,%s,,,A",
+		clock, status, lat, latHemisphere, lon, lonHemisphere,
+		p.Speed*knotsPerKmh, p.Course, t.Format("020106"))
+	gga := fmt.Sprintf("GPGGA,%s,%s,%s,%s,%s,%d,%02d,,%.1f,M,,M,,",
+		clock, lat, latHemisphere, lon, lonHemisphere, quality, p.Satellites, p.Altitude)
+	return []string{nmeaSentence(rmc), nmeaSentence(gga)}
+}
+
+// nmeaCoordinate formats degrees as NMEA (d)ddmm.mmmm
+func nmeaCoordinate(value float64, degreeDigits int, positive, negative string) (string, string) {
+	hemisphere := positive
+	if value < 0 {
+		hemisphere = negative
+		value = -value
+	}
+	degrees := math.Floor(value)
+	minutes := (value - degrees) * 60
+	return fmt.Sprintf("%0*d%07.4f", degreeDigits, int(degrees), minutes), hemisphere
+}
+
+// nmeaSentence adds the leading "$" and the checksum to a sentence body
+func nmeaSentence(body string) string {
+	var checksum byte
+	for i := 0; i < len(body); i++ {
+		checksum ^= body[i]
+	}
+	return fmt.Sprintf("$%s*%02X", body, checksum)
+}
+
+// validNMEA reports whether the sentence is well formed and its checksum, if any, matches
+func validNMEA(sentence string) bool {
+	if len(sentence) < 7 || sentence[0] != '$' {
+		return false
+	}
+	star := strings.LastIndexByte(sentence, '*')
+	if star < 0 {
+		return true
+	}
+	var checksum byte
+	for i := 1; i < star; i++ {
+		checksum ^= sentence[i]
+	}
+	return strings.EqualFold(sentence[star+1:], fmt.Sprintf("%02X", checksum))
+}
+
+// GNSSInfo describes the forwarding state
+type GNSSInfo struct {
+	Sent      uint64    `json:"sent"`      // Messages sent to the phone
+	Coalesced uint64    `json:"coalesced"` // Updates replaced by newer ones before being sent
+	Invalid   uint64    `json:"invalid"`   // Rejected NMEA sentences
+	LastSent  time.Time `json:"last_sent"`
+}
+
+// GNSSForwarder sends vehicle GNSS data to the phone, at most once per interval.
+// Updates arriving faster are coalesced so the phone always gets the latest fix.
+type GNSSForwarder struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	pending   map[string]string // Latest sentence by sentence type, e.g. "GPRMC"
+	lastFlush time.Time
+	timer     *time.Timer
+	stopped   bool
+	info      GNSSInfo
+}
+
+// NewGNSSForwarder creates a forwarder sending at most once per interval
+func NewGNSSForwarder(interval time.Duration) *GNSSForwarder {
+	if interval <= 0 {
+		interval = DefaultGNSSInterval
+	}
+	return &GNSSForwarder{
+		interval: interval,
+		pending:  make(map[string]string),
+	}
+}
+
+// UpdatePosition queues a fix for forwarding
+func (g *GNSSForwarder) UpdatePosition(position Position) {
+	for _, sentence := range position.Sentences() {
+		g.AddSentence(sentence)
+	}
+}
+
+// AddSentence queues an NMEA sentence, replacing a pending one of the same type
+func (g *GNSSForwarder) AddSentence(sentence string) {
+	sentence = strings.TrimSpace(sentence)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !validNMEA(sentence) {
+		g.info.Invalid++
+		return
+	}
+	if g.stopped {
+		return
+	}
+
+	kind := sentence[1:]
+	if comma := strings.IndexByte(kind, ','); comma >= 0 {
+		kind = kind[:comma]
+	}
+	if _, ok := g.pending[kind]; ok {
+		g.info.Coalesced++
+	}
+	g.pending[kind] = sentence
+
+	if g.timer != nil {
+		return
+	}
+	wait := g.interval - time.Since(g.lastFlush)
+	if wait < 0 {
+		wait = 0
+	}
+	g.timer = time.AfterFunc(wait, g.flush)
+}
+
+// flush sends the pending sentences
+func (g *GNSSForwarder) flush() {
+	g.mu.Lock()
+	g.timer = nil
+	if g.stopped || len(g.pending) == 0 {
+		g.mu.Unlock()
+		return
+	}
+	kinds := make([]string, 0, len(g.pending))
+	for kind := range g.pending {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	sentences := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		sentences = append(sentences, g.pending[kind])
+	}
+	g.pending = make(map[string]string)
+	g.lastFlush = time.Now()
+	g.mu.Unlock()
+
+	if !FeatureEnabled(FeatureGNSS) || currentConfig == nil {
+		return
+	}
+	if err := SendData(protocol.NewGnssData(sentences)); err != nil {
+		logger("gnss").Debugf("Failed to send GNSS data: %v", err)
+		return
+	}
+
+	g.mu.Lock()
+	g.info.Sent++
+	g.info.LastSent = time.Now()
+	g.mu.Unlock()
+}
+
+// GetInfo returns the forwarding state
+func (g *GNSSForwarder) GetInfo() GNSSInfo {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.info
+}
+
+// Stop discards pending data and stops forwarding
+func (g *GNSSForwarder) Stop() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.stopped = true
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+	g.pending = make(map[string]string)
+}
@@ -4,14 +4,16 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
-	"fmt"
-	"strings"
 
 	"github.com/mzyy94/gocarplay/protocol"
 )
 
 // SendMultiTouch sends a multi-touch message with multiple touch points
 func SendMultiTouch(touches []protocol.TouchItem) error {
+	if !FeatureEnabled(FeatureMultiTouch) {
+		return ErrFeatureDisabled
+	}
+
 	// Build the touches data
 	var buf bytes.Buffer
 	for _, touch := range touches {
@@ -91,28 +93,23 @@ func SendLogoType(logoType protocol.LogoType) error {
 	return SendData(&protocol.LogoTypeMsg{Logo: logoType})
 }
 
-// SendIconConfig sends icon configuration
-func SendIconConfig(label string) error {
-	config := map[string]interface{}{
-		"oemIconVisible": 1,
-		"name":           "AutoBox",
-		"model":          "GoCarPlay-1.00",
-		"oemIconPath":    string(protocol.FileAddressOEMIcon),
-	}
-
-	if label != "" {
-		config["oemIconLabel"] = label
-	}
-
-	var lines []string
-	for k, v := range config {
-		lines = append(lines, fmt.Sprintf("%s = %v", k, v))
-	}
-	configData := strings.Join(lines, "\n") + "\n"
-
+// SendIconConfig sends the OEM icon configuration as airplay.conf
+func SendIconConfig(config *protocol.AirplayConfig) error {
 	return SendData(&protocol.SendFile{
 		FileName: protocol.NullTermString(protocol.FileAddressAirplayConfig + "\x00"),
-		Content:  []byte(configData),
+		Content:  config.Marshal(),
+	})
+}
+
+// MicDecodeType is the audio format of microphone uplink data: 16 kHz mono 16-bit PCM
+const MicDecodeType = protocol.DecodeType(5)
+
+// SendMicAudio sends host microphone PCM data to the phone
+func SendMicAudio(pcm []byte) error {
+	return SendData(&protocol.AudioData{
+		DecodeType: MicDecodeType,
+		AudioType:  3,
+		Data:       pcm,
 	})
 }
 
@@ -1,7 +1,6 @@
 package link
 
 import (
-	"log"
 	"sync"
 	"time"
 
@@ -53,7 +52,7 @@ func (hm *HotplugManager) Start() error {
 	// Start the monitoring goroutine
 	go hm.monitorDevices()
 
-	log.Println("USB hotplug monitoring started")
+	logger("hotplug").Info("USB hotplug monitoring started")
 	return nil
 }
 
@@ -76,7 +75,7 @@ func (hm *HotplugManager) Stop() {
 	}
 	hm.mu.Unlock()
 
-	log.Println("USB hotplug monitoring stopped")
+	logger("hotplug").Info("USB hotplug monitoring stopped")
 }
 
 // monitorDevices polls for device changes
@@ -109,11 +108,11 @@ func (hm *HotplugManager) monitorDevices() {
 			// Detect state transitions
 			if isConnected && !wasConnected {
 				// Device attached
-				log.Println("USB dongle detected (hotplug event)")
+				logger("hotplug").Info("USB dongle detected (hotplug event)")
 				hm.handleAttach()
 			} else if !isConnected && wasConnected {
 				// Device detached
-				log.Println("USB dongle removed (hotplug event)")
+				logger("hotplug").Info("USB dongle removed (hotplug event)")
 				hm.handleDetach()
 			}
 
@@ -124,7 +123,7 @@ func (hm *HotplugManager) monitorDevices() {
 
 // isDevicePresent checks if any known CarPlay device is present
 func (hm *HotplugManager) isDevicePresent(ctx *gousb.Context) bool {
-	for _, device := range KnownDevices {
+	for _, device := range knownDevices() {
 		dev, err := ctx.OpenDeviceWithVIDPID(gousb.ID(device.VendorID), gousb.ID(device.ProductID))
 		if err == nil && dev != nil {
 			dev.Close()
@@ -153,10 +152,10 @@ func (hm *HotplugManager) handleAttach() {
 		// Run connection attempt in a goroutine to avoid blocking the monitor
 		go func() {
 			if err := onConnect(); err != nil {
-				log.Printf("Failed to connect to newly attached dongle: %v", err)
+				logger("hotplug").Errorf("Failed to connect to newly attached dongle: %v", err)
 				hm.stateManager.SetState(StateDisconnected)
 			} else {
-				log.Println("Successfully connected to newly attached dongle")
+				logger("hotplug").Info("Successfully connected to newly attached dongle")
 				hm.stateManager.SetState(StateConnected)
 			}
 		}()
@@ -179,7 +178,7 @@ func (hm *HotplugManager) handleDetach() {
 	if onDisconnect != nil {
 		// Run cleanup in a goroutine to avoid blocking the monitor
 		go func() {
-			log.Println("Cleaning up after dongle detachment")
+			logger("hotplug").Info("Cleaning up after dongle detachment")
 			onDisconnect()
 			hm.stateManager.SetState(StateDisconnected)
 		}()
@@ -199,3 +198,22 @@ func (hm *HotplugManager) TriggerConnectionAttempt() {
 		hm.handleAttach()
 	}
 }
+
+// Reconnect tears down the current connection and connects again if the dongle is present.
+// Used by the Watchdog when the dongle stays enumerated but stops responding.
+func (hm *HotplugManager) Reconnect() {
+	hm.mu.Lock()
+	ctx := hm.ctx
+	onDisconnect := hm.onDisconnect
+	hm.mu.Unlock()
+
+	logger("hotplug").Info("Reconnecting to dongle")
+	if onDisconnect != nil {
+		onDisconnect()
+	}
+	hm.stateManager.SetState(StateDisconnected)
+
+	if ctx != nil && hm.isDevicePresent(ctx) {
+		hm.handleAttach()
+	}
+}
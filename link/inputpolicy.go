@@ -0,0 +1,375 @@
+package link
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mzyy94/gocarplay"
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// Input policy defaults
+const (
+	DefaultInputRateWindow = 10 * time.Second
+	InputAuditHistory      = 100  // Blocked events kept for GetRecent
+	InputAuditQueue        = 1000 // Blocked events buffered per subscriber
+)
+
+// InputPolicyMode selects how input is restricted above the speed limit
+type InputPolicyMode string
+
+const (
+	// InputPolicyBlock blocks all restricted input while moving
+	InputPolicyBlock InputPolicyMode = "block"
+	// InputPolicyRateLimit allows a limited number of gestures per window while moving
+	InputPolicyRateLimit InputPolicyMode = "rate_limit"
+)
+
+var (
+	// ErrInputBlocked is returned for input blocked while moving
+	ErrInputBlocked = errors.New("Input blocked while moving")
+	// ErrInputRateLimited is returned for input exceeding the rate limit while moving
+	ErrInputRateLimited = errors.New("Input rate limit exceeded while moving")
+)
+
+// inputCommands are the commands triggered by the user, as opposed to
+// commands the service sends to control the dongle
+var inputCommands = []protocol.CarPlayType{
+	protocol.BtnSiri,
+	protocol.BtnLeft, protocol.BtnRight, protocol.BtnSelectDown, protocol.BtnSelectUp,
+	protocol.BtnBack, protocol.BtnUp, protocol.BtnDown, protocol.BtnHome,
+	protocol.BtnPlay, protocol.BtnPause, protocol.BtnPlayOrPause,
+	protocol.BtnNextTrack, protocol.BtnPrevTrack,
+	protocol.AcceptPhoneCall, protocol.RejectPhoneCall,
+}
+
+// DefaultAllowedCommands are allowed at any speed: media keys, call handling
+// and the voice assistant need no look at the screen
+var DefaultAllowedCommands = []protocol.CarPlayType{
+	protocol.BtnSiri,
+	protocol.BtnPlay, protocol.BtnPause, protocol.BtnPlayOrPause,
+	protocol.BtnNextTrack, protocol.BtnPrevTrack,
+	protocol.AcceptPhoneCall, protocol.RejectPhoneCall,
+}
+
+// InputAudit describes a blocked input event. A touch gesture is reported
+// once, when its first message is blocked.
+type InputAudit struct {
+	Time   time.Time `json:"time"`
+	Input  string    `json:"input"` // "touch", "multi_touch" or the command, e.g. "BtnHome"
+	Speed  float64   `json:"speed"` // km/h, -1 = unknown
+	Reason string    `json:"reason"`
+}
+
+// InputPolicyStats counts input messages by decision
+type InputPolicyStats struct {
+	Allowed      uint64 `json:"allowed"`
+	Blocked      uint64 `json:"blocked"`
+	RateLimited  uint64 `json:"rate_limited"`
+	AuditDropped uint64 `json:"audit_dropped"` // Blocked events a full subscriber queue missed
+}
+
+// gestureState tracks a touch gesture across its messages
+type gestureState int
+
+const (
+	gestureNone gestureState = iota
+	gestureAllowed
+	gestureBlocked
+)
+
+// InputPolicy restricts touch and key input above a speed limit. Decisions
+// are taken per gesture: moves and the release follow the decision taken
+// when the finger went down, so no touch is left pressed on the phone.
+// An unknown or stale speed restricts input unless configured otherwise.
+type InputPolicy struct {
+	mu           sync.Mutex
+	mode         InputPolicyMode
+	speedLimit   float64 // km/h, 0 = never restrict
+	speedMaxAge  time.Duration
+	allowUnknown bool
+	rateLimit    int
+	rateWindow   time.Duration
+	allowed      map[protocol.CarPlayType]bool
+	vehicle      func() VehicleState
+	starts       []time.Time // Gestures allowed within the rate window
+	touch        gestureState
+	multiTouch   gestureState
+	stats        InputPolicyStats
+	recent       []InputAudit
+	listeners    []chan InputAudit
+}
+
+var activeInputPolicy *InputPolicy
+var inputPolicyMutex sync.RWMutex
+
+// NewInputPolicy creates an input policy reading the current speed in km/h from vehicle
+func NewInputPolicy(config gocarplay.InputPolicyConfig, vehicle func() VehicleState) (*InputPolicy, error) {
+	p := &InputPolicy{
+		mode:         InputPolicyBlock,
+		speedLimit:   config.SpeedLimit,
+		speedMaxAge:  time.Duration(config.SpeedMaxAge) * time.Millisecond,
+		allowUnknown: config.AllowUnknown,
+		rateLimit:    config.RateLimit,
+		rateWindow:   DefaultInputRateWindow,
+		allowed:      make(map[protocol.CarPlayType]bool),
+		vehicle:      vehicle,
+		listeners:    make([]chan InputAudit, 0),
+	}
+
+	switch InputPolicyMode(config.Mode) {
+	case "", InputPolicyBlock:
+	case InputPolicyRateLimit:
+		p.mode = InputPolicyRateLimit
+	default:
+		return nil, fmt.Errorf("unknown input policy mode: %s", config.Mode)
+	}
+	if config.RateWindow > 0 {
+		p.rateWindow = time.Duration(config.RateWindow) * time.Millisecond
+	}
+
+	if config.AllowedCommands == nil {
+		for _, command := range DefaultAllowedCommands {
+			p.allowed[command] = true
+		}
+	}
+	for _, name := range config.AllowedCommands {
+		command, ok := parseInputCommand(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown input command: %s", name)
+		}
+		p.allowed[command] = true
+	}
+	return p, nil
+}
+
+// parseInputCommand returns the input command with the given name, e.g. "BtnHome"
+func parseInputCommand(name string) (protocol.CarPlayType, bool) {
+	for _, command := range inputCommands {
+		if command.GoString() == name {
+			return command, true
+		}
+	}
+	return 0, false
+}
+
+// SetInputPolicy makes SendData check touch and key input against the policy.
+// A nil policy allows all input.
+func SetInputPolicy(p *InputPolicy) {
+	inputPolicyMutex.Lock()
+	defer inputPolicyMutex.Unlock()
+	activeInputPolicy = p
+}
+
+// checkInputPolicy checks a message against the active policy
+func checkInputPolicy(msg interface{}) error {
+	inputPolicyMutex.RLock()
+	p := activeInputPolicy
+	inputPolicyMutex.RUnlock()
+
+	if p == nil {
+		return nil
+	}
+	return p.Check(msg)
+}
+
+// Mode returns the policy mode
+func (p *InputPolicy) Mode() InputPolicyMode {
+	return p.mode
+}
+
+// SpeedLimit returns the speed in km/h above which input is restricted
+func (p *InputPolicy) SpeedLimit() float64 {
+	return p.speedLimit
+}
+
+// Restricted reports whether input is currently restricted
+func (p *InputPolicy) Restricted() bool {
+	_, restricted := p.currentSpeed()
+	return restricted
+}
+
+// currentSpeed returns the speed, or -1 while unknown or stale,
+// and whether input is restricted
+func (p *InputPolicy) currentSpeed() (float64, bool) {
+	if p.speedLimit <= 0 {
+		return 0, false
+	}
+	state := p.vehicle()
+	if state.Speed == nil || (p.speedMaxAge > 0 && time.Since(state.SpeedUpdated) > p.speedMaxAge) {
+		return -1, !p.allowUnknown
+	}
+	return *state.Speed, *state.Speed > p.speedLimit
+}
+
+// Check decides whether an input message may be sent. Other messages are always allowed.
+func (p *InputPolicy) Check(msg interface{}) error {
+	switch msg := msg.(type) {
+	case *protocol.Touch:
+		start := msg.Action == protocol.TouchDown
+		end := msg.Action == protocol.TouchUp
+		return p.checkGesture(&p.touch, "touch", start, end)
+
+	case *protocol.MultiTouch:
+		start, end := false, true
+		for _, item := range msg.Touches {
+			if item.Action == protocol.MultiTouchDown {
+				start = true
+			}
+			if item.Action != protocol.MultiTouchUp {
+				end = false
+			}
+		}
+		return p.checkGesture(&p.multiTouch, "multi_touch", start, end)
+
+	case *protocol.CarPlay:
+		if !isInputCommand(msg.Type) {
+			return nil
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.allowed[msg.Type] {
+			p.stats.Allowed++
+			return nil
+		}
+		return p.decide(msg.Type.GoString())
+	}
+	return nil
+}
+
+// checkGesture applies the decision taken at the start of a gesture to all its messages
+func (p *InputPolicy) checkGesture(state *gestureState, input string, start, end bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// A release without a known start is harmless, while a move without one,
+	// e.g. after a restart, starts a gesture
+	if end && !start && *state == gestureNone {
+		p.stats.Allowed++
+		return nil
+	}
+	if start || *state == gestureNone {
+		*state = gestureAllowed
+		if err := p.decide(input); err != nil {
+			*state = gestureBlocked
+			if end {
+				*state = gestureNone
+			}
+			return err
+		}
+	} else if *state == gestureBlocked {
+		p.stats.Blocked++
+		if end {
+			*state = gestureNone
+		}
+		return ErrInputBlocked
+	} else {
+		p.stats.Allowed++
+	}
+
+	if end {
+		*state = gestureNone
+	}
+	return nil
+}
+
+// decide takes the decision for a new gesture or key press, auditing blocked input.
+// The caller must hold p.mu.
+func (p *InputPolicy) decide(input string) error {
+	speed, restricted := p.currentSpeed()
+	if !restricted {
+		p.stats.Allowed++
+		return nil
+	}
+
+	if p.mode == InputPolicyRateLimit {
+		now := time.Now()
+		kept := p.starts[:0]
+		for _, start := range p.starts {
+			if now.Sub(start) < p.rateWindow {
+				kept = append(kept, start)
+			}
+		}
+		p.starts = kept
+		if len(p.starts) < p.rateLimit {
+			p.starts = append(p.starts, now)
+			p.stats.Allowed++
+			return nil
+		}
+		p.stats.RateLimited++
+		p.audit(input, speed, "rate_limited")
+		return ErrInputRateLimited
+	}
+
+	p.stats.Blocked++
+	p.audit(input, speed, "blocked")
+	return ErrInputBlocked
+}
+
+// audit records a blocked event and notifies listeners. The caller must hold p.mu.
+func (p *InputPolicy) audit(input string, speed float64, reason string) {
+	event := InputAudit{Time: time.Now(), Input: input, Speed: speed, Reason: reason}
+
+	p.recent = append(p.recent, event)
+	if len(p.recent) > InputAuditHistory {
+		p.recent = p.recent[len(p.recent)-InputAuditHistory:]
+	}
+
+	for _, ch := range p.listeners {
+		select {
+		case ch <- event:
+		default:
+			// Count the miss, the event is still kept for GetRecent
+			p.stats.AuditDropped++
+		}
+	}
+}
+
+func isInputCommand(command protocol.CarPlayType) bool {
+	for _, input := range inputCommands {
+		if input == command {
+			return true
+		}
+	}
+	return false
+}
+
+// GetStats returns the number of input messages by decision
+func (p *InputPolicy) GetStats() InputPolicyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// GetRecent returns the most recent blocked events, oldest first
+func (p *InputPolicy) GetRecent() []InputAudit {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]InputAudit(nil), p.recent...)
+}
+
+// Subscribe creates a new channel that will receive blocked events
+func (p *InputPolicy) Subscribe() chan InputAudit {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ch := make(chan InputAudit, InputAuditQueue)
+	p.listeners = append(p.listeners, ch)
+	return ch
+}
+
+// Unsubscribe removes a listener channel
+func (p *InputPolicy) Unsubscribe(ch chan InputAudit) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, listener := range p.listeners {
+		if listener == ch {
+			p.listeners = append(p.listeners[:i], p.listeners[i+1:]...)
+			close(ch)
+			break
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package link
+
+import (
+	"sync"
+
+	"github.com/mzyy94/gocarplay/logging"
+)
+
+var baseLogger = logging.Default()
+var loggerMutex sync.RWMutex
+
+// SetLogger makes the link package log through l.
+// Component loggers such as "usb", "link" and "hotplug" are derived from it.
+func SetLogger(l *logging.Logger) {
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+	baseLogger = l
+}
+
+// logger returns the logger for a component
+func logger(component string) *logging.Logger {
+	loggerMutex.RLock()
+	defer loggerMutex.RUnlock()
+	return baseLogger.Named(component)
+}
@@ -0,0 +1,55 @@
+package link
+
+import (
+	"sync"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// Direction tells whether a message was sent to or received from the dongle
+type Direction int
+
+const (
+	// DirectionReceived marks messages received from the dongle
+	DirectionReceived Direction = iota
+	// DirectionSent marks messages sent to the dongle
+	DirectionSent
+)
+
+// String returns the string representation of the direction
+func (d Direction) String() string {
+	switch d {
+	case DirectionReceived:
+		return "received"
+	case DirectionSent:
+		return "sent"
+	default:
+		return "unknown"
+	}
+}
+
+// MessageObserver is called for every message exchanged with the dongle.
+// payload is the raw message body and must not be retained or modified.
+// Observers run on the sending or receiving goroutine and must not block.
+type MessageObserver func(direction Direction, header protocol.Header, payload []byte, msg interface{})
+
+var observers []MessageObserver
+var observersMutex sync.RWMutex
+
+// AddMessageObserver registers an observer for all sent and received messages
+func AddMessageObserver(observer MessageObserver) {
+	observersMutex.Lock()
+	defer observersMutex.Unlock()
+	observers = append(observers, observer)
+}
+
+// notifyObservers passes a message to all registered observers
+func notifyObservers(direction Direction, header protocol.Header, payload []byte, msg interface{}) {
+	observersMutex.RLock()
+	list := observers
+	observersMutex.RUnlock()
+
+	for _, observer := range list {
+		observer(direction, header, payload, msg)
+	}
+}
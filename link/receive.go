@@ -29,5 +29,8 @@ func ReceiveMessage(epIn *gousb.InEndpoint, ctx context.Context) (interface{}, e
 		}
 	}
 	err = protocol.Unmarshal(buf, payload)
+	if err == nil {
+		notifyObservers(DirectionReceived, hdr, buf, payload)
+	}
 	return payload, err
 }
@@ -22,5 +22,10 @@ func SendMessage(epOut *gousb.OutEndpoint, msg interface{}) error {
 	if len(buf) > 16 {
 		_, err = epOut.Write(buf[16:])
 	}
+	if err == nil {
+		var hdr protocol.Header
+		protocol.Unmarshal(buf[:16], &hdr)
+		notifyObservers(DirectionSent, hdr, buf[16:], msg)
+	}
 	return err
 }
@@ -0,0 +1,223 @@
+package link
+
+import (
+	"sync"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// SessionState represents the phase of the phone session on top of the dongle connection
+type SessionState int
+
+const (
+	// SessionNone indicates no dongle is attached
+	SessionNone SessionState = iota
+	// SessionDongleAttached indicates the dongle is attached but the handshake is not done
+	SessionDongleAttached
+	// SessionHandshakeDone indicates the dongle answered Open with Opened
+	SessionHandshakeDone
+	// SessionWaitingForPhone indicates the dongle is configured and no phone is connected
+	SessionWaitingForPhone
+	// SessionPhonePlugged indicates a phone is connected but not streaming yet
+	SessionPhonePlugged
+	// SessionStreaming indicates the phone session is running
+	SessionStreaming
+	// SessionPhoneUnplugged indicates the phone was disconnected
+	SessionPhoneUnplugged
+	// SessionNegotiationFailed indicates the dongle could not set up the phone session
+	SessionNegotiationFailed
+)
+
+// String returns the string representation of the session state
+func (s SessionState) String() string {
+	switch s {
+	case SessionNone:
+		return "none"
+	case SessionDongleAttached:
+		return "dongle_attached"
+	case SessionHandshakeDone:
+		return "handshake_done"
+	case SessionWaitingForPhone:
+		return "waiting_for_phone"
+	case SessionPhonePlugged:
+		return "phone_plugged"
+	case SessionStreaming:
+		return "streaming"
+	case SessionPhoneUnplugged:
+		return "phone_unplugged"
+	case SessionNegotiationFailed:
+		return "negotiation_failed"
+	default:
+		return "unknown"
+	}
+}
+
+// SessionInfo is a snapshot of the phone session
+type SessionInfo struct {
+	State     SessionState
+	PhoneType protocol.PhoneType // Valid from SessionPhonePlugged on
+	Wireless  bool               // True if the phone is connected over WiFi
+	Phase     protocol.PhaseType // Last phase reported by the dongle, PhaseUnknown if none
+}
+
+// SessionManager tracks the phone session state driven by dongle messages
+type SessionManager struct {
+	mu         sync.RWMutex
+	info       SessionInfo
+	configured bool
+	listeners  []chan SessionInfo
+}
+
+// NewSessionManager creates a new session manager
+func NewSessionManager() *SessionManager {
+	return &SessionManager{
+		info:      SessionInfo{State: SessionNone, Phase: protocol.PhaseUnknown},
+		listeners: make([]chan SessionInfo, 0),
+	}
+}
+
+// GetInfo returns the current session snapshot
+func (sm *SessionManager) GetInfo() SessionInfo {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.info
+}
+
+// GetState returns the current session state
+func (sm *SessionManager) GetState() SessionState {
+	return sm.GetInfo().State
+}
+
+// DongleAttached marks the start of a new dongle connection
+func (sm *SessionManager) DongleAttached() {
+	sm.update(func(info *SessionInfo) {
+		sm.configured = false
+		*info = SessionInfo{State: SessionDongleAttached, Phase: protocol.PhaseUnknown}
+	})
+}
+
+// DongleDetached resets the session after the dongle is gone
+func (sm *SessionManager) DongleDetached() {
+	sm.update(func(info *SessionInfo) {
+		sm.configured = false
+		*info = SessionInfo{State: SessionNone, Phase: protocol.PhaseUnknown}
+	})
+}
+
+// MarkConfigured records that the dongle configuration was sent.
+// Once the handshake is done the session starts waiting for a phone.
+func (sm *SessionManager) MarkConfigured() {
+	sm.update(func(info *SessionInfo) {
+		sm.configured = true
+		if info.State == SessionHandshakeDone {
+			info.State = SessionWaitingForPhone
+		}
+	})
+}
+
+// HandleMessage updates the session state from a received dongle message
+func (sm *SessionManager) HandleMessage(msg interface{}) {
+	switch msg := msg.(type) {
+	case *protocol.Opened:
+		sm.update(func(info *SessionInfo) {
+			if info.State != SessionDongleAttached {
+				return
+			}
+			if sm.configured {
+				*info = SessionInfo{State: SessionWaitingForPhone, Phase: protocol.PhaseUnknown}
+			} else {
+				*info = SessionInfo{State: SessionHandshakeDone, Phase: protocol.PhaseUnknown}
+			}
+		})
+	case *protocol.Plugged:
+		sm.update(func(info *SessionInfo) {
+			*info = SessionInfo{
+				State:     SessionPhonePlugged,
+				PhoneType: msg.PhoneType,
+				Wireless:  msg.Wifi != 0,
+				Phase:     info.Phase,
+			}
+		})
+	case *protocol.Unplugged:
+		sm.update(func(info *SessionInfo) {
+			*info = SessionInfo{State: SessionPhoneUnplugged, Phase: protocol.PhaseUnknown}
+		})
+	case *protocol.Phase:
+		sm.update(func(info *SessionInfo) {
+			current := info.State
+			info.Phase = msg.PhaseValue
+			switch msg.PhaseValue {
+			case protocol.PhaseRunning:
+				if current == SessionPhonePlugged {
+					info.State = SessionStreaming
+				}
+			case protocol.PhaseIdle:
+				switch current {
+				case SessionHandshakeDone, SessionPhoneUnplugged, SessionNegotiationFailed:
+					*info = SessionInfo{State: SessionWaitingForPhone, Phase: msg.PhaseValue}
+				}
+			case protocol.PhaseNegotiationFailed:
+				if current != SessionNone && current != SessionDongleAttached {
+					*info = SessionInfo{State: SessionNegotiationFailed, Phase: msg.PhaseValue}
+				}
+			}
+		})
+	case *protocol.VideoData:
+		// Some firmwares start streaming without reporting the running phase
+		sm.update(func(info *SessionInfo) {
+			if info.State == SessionPhonePlugged {
+				info.State = SessionStreaming
+			}
+		})
+	}
+}
+
+// update decides and stores the new session snapshot under one lock, so
+// concurrent transitions cannot overwrite each other, and notifies listeners on change
+func (sm *SessionManager) update(fn func(info *SessionInfo)) {
+	sm.mu.Lock()
+	old := sm.info
+	fn(&sm.info)
+	info := sm.info
+	listeners := sm.listeners
+	sm.mu.Unlock()
+
+	if old == info {
+		return
+	}
+
+	if old.State != info.State {
+		logger("session").Infof("%v -> %v", old.State, info.State)
+	}
+	for _, ch := range listeners {
+		select {
+		case ch <- info:
+		default:
+			// Skip if channel is full
+		}
+	}
+}
+
+// Subscribe creates a new channel that will receive session change notifications
+func (sm *SessionManager) Subscribe() chan SessionInfo {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	ch := make(chan SessionInfo, 10)
+	sm.listeners = append(sm.listeners, ch)
+	return ch
+}
+
+// Unsubscribe removes a listener channel
+func (sm *SessionManager) Unsubscribe(ch chan SessionInfo) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for i, listener := range sm.listeners {
+		if listener == ch {
+			sm.listeners = append(sm.listeners[:i], sm.listeners[i+1:]...)
+			close(ch)
+			break
+		}
+	}
+}
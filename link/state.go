@@ -14,6 +14,8 @@ const (
 	StateConnecting
 	// StateConnected indicates the dongle is connected and operational
 	StateConnected
+	// StateRecovering indicates the dongle stopped responding and recovery is in progress
+	StateRecovering
 )
 
 // String returns the string representation of the connection state
@@ -25,6 +27,8 @@ func (s ConnectionState) String() string {
 		return "connecting"
 	case StateConnected:
 		return "connected"
+	case StateRecovering:
+		return "recovering"
 	default:
 		return "unknown"
 	}
@@ -0,0 +1,243 @@
+package link
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mzyy94/gocarplay"
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// Time sync defaults
+const (
+	DefaultTimeSyncInterval = 10 * time.Minute
+	ClockJumpThreshold      = 2 * time.Second // Wall clock deviation from elapsed time that counts as a jump
+	GPSResyncThreshold      = time.Second     // GPS offset change that triggers a resync
+	GPSOffsetTolerance      = 2 * time.Second // GPS offsets below this are publish latency, not clock error
+)
+
+// ClockSource selects the clock the dongle time is taken from
+type ClockSource string
+
+const (
+	// ClockSystem uses the system clock
+	ClockSystem ClockSource = "system"
+	// ClockGPS uses the time of the last GPS fix, advanced by the elapsed time,
+	// and falls back to the system clock until the first fix
+	ClockGPS ClockSource = "gps"
+)
+
+// TimeSync keeps the dongle clock in sync by resending the time periodically,
+// after system clock jumps and when a GPS fix corrects the clock
+type TimeSync struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	source    ClockSource
+	location  *time.Location // nil sends UTC
+	gpsOffset time.Duration  // GPS time minus system time
+	gpsValid  bool
+	lastSync  time.Time
+	stopChan  chan struct{}
+	doneChan  chan struct{}
+	running   bool
+}
+
+var activeTimeSync *TimeSync
+var timeSyncMutex sync.RWMutex
+
+// NewTimeSync creates a time sync for the given configuration
+func NewTimeSync(config gocarplay.TimeSyncConfig) (*TimeSync, error) {
+	ts := &TimeSync{
+		interval: DefaultTimeSyncInterval,
+		source:   ClockSystem,
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+	if config.Interval > 0 {
+		ts.interval = time.Duration(config.Interval) * time.Millisecond
+	}
+	switch ClockSource(config.Source) {
+	case "", ClockSystem:
+	case ClockGPS:
+		ts.source = ClockGPS
+	default:
+		return nil, fmt.Errorf("unknown clock source: %s", config.Source)
+	}
+	if config.Timezone != "" {
+		location, err := time.LoadLocation(config.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %s: %v", config.Timezone, err)
+		}
+		ts.location = location
+	}
+	return ts, nil
+}
+
+// Now returns the current time from the configured clock source
+func (ts *TimeSync) Now() time.Time {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	now := time.Now()
+	if ts.source == ClockGPS && ts.gpsValid {
+		now = now.Add(ts.gpsOffset)
+	}
+	return now
+}
+
+// SyncTime returns the time sent to the dongle in ms since the epoch.
+// With a timezone configured the local wall-clock time of that zone is sent,
+// because the dongle has no notion of timezones.
+func (ts *TimeSync) SyncTime() int64 {
+	now := ts.Now()
+
+	ts.mu.Lock()
+	location := ts.location
+	ts.mu.Unlock()
+
+	if location == nil {
+		return now.UnixMilli()
+	}
+	_, offset := now.In(location).Zone()
+	return now.UnixMilli() + int64(offset)*1000
+}
+
+// GPSFix records the time of a GPS fix and resyncs if it corrects the clock.
+// The fix arrives late by the Redis publish latency, so small offsets are
+// taken as the system clock being right.
+func (ts *TimeSync) GPSFix(fix time.Time) {
+	offset := time.Until(fix)
+	if absDuration(offset) < GPSOffsetTolerance {
+		offset = 0
+	}
+
+	ts.mu.Lock()
+	changed := absDuration(offset-ts.gpsOffset) >= GPSResyncThreshold
+	ts.gpsOffset = offset
+	ts.gpsValid = true
+	source := ts.source
+	ts.mu.Unlock()
+
+	if changed && source == ClockGPS {
+		logger("timesync").Infof("GPS fix, clock offset %v", offset.Round(time.Millisecond))
+		ts.Sync()
+	}
+}
+
+// Sync sends the current time to the dongle if it is configured.
+// Only syncTime is sent, so the session is not renegotiated mid-ride.
+func (ts *TimeSync) Sync() error {
+	ts.markSynced()
+
+	if currentConfig == nil {
+		return nil
+	}
+
+	logger("timesync").Info("Sending time to dongle")
+	syncTime := ts.SyncTime()
+	msg, err := protocol.NewBoxSettingsUpdate(&protocol.BoxSettingsUpdate{SyncTime: &syncTime})
+	if err != nil {
+		return err
+	}
+	return SendData(msg)
+}
+
+// Start makes SendBoxSettings use this clock and begins periodic syncing
+func (ts *TimeSync) Start() {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.running {
+		return
+	}
+	ts.running = true
+	ts.lastSync = time.Now()
+
+	timeSyncMutex.Lock()
+	activeTimeSync = ts
+	timeSyncMutex.Unlock()
+
+	go ts.run()
+	logger("timesync").Infof("Started (source %s, interval %v)", ts.source, ts.interval)
+}
+
+// Stop stops periodic syncing
+func (ts *TimeSync) Stop() {
+	ts.mu.Lock()
+	if !ts.running {
+		ts.mu.Unlock()
+		return
+	}
+	ts.running = false
+	ts.mu.Unlock()
+
+	timeSyncMutex.Lock()
+	if activeTimeSync == ts {
+		activeTimeSync = nil
+	}
+	timeSyncMutex.Unlock()
+
+	close(ts.stopChan)
+	<-ts.doneChan
+	logger("timesync").Info("Stopped")
+}
+
+func (ts *TimeSync) run() {
+	defer close(ts.doneChan)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ts.stopChan:
+			return
+		case now := <-ticker.C:
+			// Elapsed monotonic time vs. elapsed wall-clock time reveals clock jumps
+			jump := now.Round(0).Sub(last.Round(0)) - now.Sub(last)
+			last = now
+
+			ts.mu.Lock()
+			due := now.Sub(ts.lastSync) >= ts.interval
+			ts.mu.Unlock()
+
+			if absDuration(jump) >= ClockJumpThreshold {
+				logger("timesync").Infof("System clock jumped by %v", jump.Round(time.Millisecond))
+				due = true
+			}
+			if due {
+				if err := ts.Sync(); err != nil {
+					logger("timesync").Errorf("Failed to send time: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// currentSyncTime returns the dongle time from the active TimeSync, or the system clock
+func currentSyncTime() int64 {
+	timeSyncMutex.RLock()
+	ts := activeTimeSync
+	timeSyncMutex.RUnlock()
+
+	if ts == nil {
+		return time.Now().UnixMilli()
+	}
+	ts.markSynced()
+	return ts.SyncTime()
+}
+
+// markSynced restarts the periodic sync interval
+func (ts *TimeSync) markSynced() {
+	ts.mu.Lock()
+	ts.lastSync = time.Now()
+	ts.mu.Unlock()
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
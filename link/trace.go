@@ -0,0 +1,182 @@
+package link
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// DefaultTraceSize is the number of messages kept by a Tracer
+const DefaultTraceSize = 1000
+
+// TraceEntry is a message recorded by the Tracer
+type TraceEntry struct {
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Type      string    `json:"type"`
+	TypeID    uint32    `json:"type_id"`
+	Length    uint32    `json:"length"`
+	Decoded   string    `json:"decoded"`
+	media     bool
+}
+
+// TraceFilter selects trace entries
+type TraceFilter struct {
+	Types        []string // Message type names, e.g. "Touch"; empty matches all
+	Direction    string   // "sent" or "received"; empty matches both
+	ExcludeMedia bool     // Leave out video and audio messages
+}
+
+// Match reports whether the entry passes the filter
+func (f TraceFilter) Match(entry TraceEntry) bool {
+	if f.ExcludeMedia && entry.media {
+		return false
+	}
+	if f.Direction != "" && f.Direction != entry.Direction {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if strings.EqualFold(t, entry.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tracer records messages exchanged with the dongle into a ring buffer.
+// Bulky video and audio payloads are summarized by their length.
+type Tracer struct {
+	mu        sync.Mutex
+	enabled   bool
+	entries   []TraceEntry
+	next      int // Ring position of the next entry
+	full      bool
+	seq       uint64
+	listeners []chan TraceEntry
+}
+
+// NewTracer creates a disabled tracer keeping the last size messages
+func NewTracer(size int) *Tracer {
+	if size <= 0 {
+		size = DefaultTraceSize
+	}
+	return &Tracer{
+		entries:   make([]TraceEntry, size),
+		listeners: make([]chan TraceEntry, 0),
+	}
+}
+
+// Attach hooks the tracer into SendMessage and ReceiveMessage
+func (t *Tracer) Attach() {
+	AddMessageObserver(t.observe)
+}
+
+// SetEnabled starts or stops recording
+func (t *Tracer) SetEnabled(enabled bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.enabled = enabled
+}
+
+// Enabled reports whether the tracer is recording
+func (t *Tracer) Enabled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.enabled
+}
+
+// Clear removes all recorded entries
+func (t *Tracer) Clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.next = 0
+	t.full = false
+}
+
+// Entries returns the recorded entries matching the filter, oldest first
+func (t *Tracer) Entries(filter TraceFilter) []TraceEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var ordered []TraceEntry
+	if t.full {
+		ordered = append(ordered, t.entries[t.next:]...)
+	}
+	ordered = append(ordered, t.entries[:t.next]...)
+
+	result := make([]TraceEntry, 0, len(ordered))
+	for _, entry := range ordered {
+		if filter.Match(entry) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// observe implements MessageObserver
+func (t *Tracer) observe(direction Direction, header protocol.Header, payload []byte, msg interface{}) {
+	if !t.Enabled() {
+		return
+	}
+
+	decoded, media := protocol.DescribePayload(msg)
+	entry := TraceEntry{
+		Time:      time.Now(),
+		Direction: direction.String(),
+		Type:      protocol.MessageName(msg),
+		TypeID:    header.Type,
+		Length:    header.Length,
+		Decoded:   decoded,
+		media:     media,
+	}
+
+	t.mu.Lock()
+	t.seq++
+	entry.Seq = t.seq
+	t.entries[t.next] = entry
+	t.next = (t.next + 1) % len(t.entries)
+	if t.next == 0 {
+		t.full = true
+	}
+
+	// Send under the lock so Unsubscribe cannot close a channel in between;
+	// the sends never block
+	for _, ch := range t.listeners {
+		select {
+		case ch <- entry:
+		default:
+			// Skip if channel is full
+		}
+	}
+	t.mu.Unlock()
+}
+
+// Subscribe creates a new channel that will receive recorded entries as they happen
+func (t *Tracer) Subscribe() chan TraceEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ch := make(chan TraceEntry, 100)
+	t.listeners = append(t.listeners, ch)
+	return ch
+}
+
+// Unsubscribe removes a listener channel
+func (t *Tracer) Unsubscribe(ch chan TraceEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, listener := range t.listeners {
+		if listener == ch {
+			t.listeners = append(t.listeners[:i], t.listeners[i+1:]...)
+			close(ch)
+			break
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package link
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// DefaultVehicleInfoInterval is the minimum time between vehicle info messages sent to the phone
+const DefaultVehicleInfoInterval = time.Second
+
+// VehicleState is the latest vehicle telemetry. Nil fields are unknown.
+type VehicleState struct {
+	Speed        *float64  `json:"speed"`         // km/h
+	BatteryLevel *int32    `json:"battery_level"` // State of charge in percent
+	Range        *int32    `json:"range"`         // Remaining range in km
+	SpeedUpdated time.Time `json:"speed_updated"` // When Speed was last reported
+	Updated      time.Time `json:"updated"`
+}
+
+// VehicleUpdate changes part of the vehicle state. Nil fields are left unchanged.
+type VehicleUpdate struct {
+	Speed        *float64
+	BatteryLevel *int32
+	Range        *int32
+}
+
+// VehicleManager tracks vehicle telemetry and, if enabled, forwards it to the phone
+type VehicleManager struct {
+	mu          sync.Mutex
+	state       VehicleState
+	forwarding  bool
+	interval    time.Duration
+	lastForward time.Time
+	timer       *time.Timer
+	listeners   []chan VehicleState
+}
+
+// NewVehicleManager creates a new vehicle manager. The state is only sent to
+// the phone if forwarding is set, as the VehicleInfo format is unconfirmed.
+func NewVehicleManager(forwarding bool) *VehicleManager {
+	return &VehicleManager{
+		forwarding: forwarding,
+		interval:   DefaultVehicleInfoInterval,
+		listeners:  make([]chan VehicleState, 0),
+	}
+}
+
+// GetState returns the latest vehicle state
+func (vm *VehicleManager) GetState() VehicleState {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	return vm.state
+}
+
+// Update merges new telemetry into the vehicle state
+func (vm *VehicleManager) Update(update VehicleUpdate) {
+	vm.update(func(state *VehicleState) {
+		if update.Speed != nil {
+			state.Speed = update.Speed
+			state.SpeedUpdated = time.Now()
+		}
+		if update.BatteryLevel != nil {
+			state.BatteryLevel = update.BatteryLevel
+		}
+		if update.Range != nil {
+			state.Range = update.Range
+		}
+		state.Updated = time.Now()
+	})
+	vm.scheduleForward()
+}
+
+// Speed returns the current speed in km/h, nil while unknown
+func (vm *VehicleManager) Speed() *float64 {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	return vm.state.Speed
+}
+
+// scheduleForward sends the state to the phone, at most once per interval
+func (vm *VehicleManager) scheduleForward() {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	if !vm.forwarding || vm.timer != nil {
+		return
+	}
+	wait := vm.interval - time.Since(vm.lastForward)
+	if wait < 0 {
+		wait = 0
+	}
+	vm.timer = time.AfterFunc(wait, vm.forward)
+}
+
+// forward sends the fields supported by the vehicle info message
+func (vm *VehicleManager) forward() {
+	vm.mu.Lock()
+	vm.timer = nil
+	vm.lastForward = time.Now()
+	state := vm.state
+	vm.mu.Unlock()
+
+	if !FeatureEnabled(FeatureVehicleInfo) || currentConfig == nil {
+		return
+	}
+	msg, err := protocol.NewVehicleInfo(&protocol.VehicleInfoData{
+		Speed:        state.Speed,
+		BatteryLevel: state.BatteryLevel,
+		Range:        state.Range,
+	})
+	if err != nil {
+		logger("vehicle").Errorf("Failed to encode vehicle info: %v", err)
+		return
+	}
+	if err := SendData(msg); err != nil {
+		logger("vehicle").Debugf("Failed to send vehicle info: %v", err)
+	}
+}
+
+// Stop cancels a pending forward
+func (vm *VehicleManager) Stop() {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	if vm.timer != nil {
+		vm.timer.Stop()
+		vm.timer = nil
+	}
+}
+
+// update applies a change and notifies listeners
+func (vm *VehicleManager) update(fn func(state *VehicleState)) {
+	vm.mu.Lock()
+	fn(&vm.state)
+	state := vm.state
+	listeners := vm.listeners
+	vm.mu.Unlock()
+
+	for _, ch := range listeners {
+		select {
+		case ch <- state:
+		default:
+			// Skip if channel is full
+		}
+	}
+}
+
+// Subscribe creates a new channel that will receive vehicle state updates
+func (vm *VehicleManager) Subscribe() chan VehicleState {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	ch := make(chan VehicleState, 10)
+	vm.listeners = append(vm.listeners, ch)
+	return ch
+}
+
+// Unsubscribe removes a listener channel
+func (vm *VehicleManager) Unsubscribe(ch chan VehicleState) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	for i, listener := range vm.listeners {
+		if listener == ch {
+			vm.listeners = append(vm.listeners[:i], vm.listeners[i+1:]...)
+			close(ch)
+			break
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package link
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultLivenessTimeout is how long the dongle may stay silent before recovery starts
+const DefaultLivenessTimeout = 3 * HeartbeatInterval
+
+// DefaultIdleLivenessTimeout applies while no phone is attached. An idle dongle
+// is not known to answer heartbeats, so it may stay silent longer; the first
+// recovery step re-sends Open, which a responsive dongle answers with Opened.
+const DefaultIdleLivenessTimeout = time.Minute
+
+// RecoveryStep identifies an escalation step taken by the Watchdog
+type RecoveryStep int
+
+const (
+	// RecoveryNone indicates the dongle is responsive
+	RecoveryNone RecoveryStep = iota
+	// RecoveryResendOpen re-sends the Open handshake
+	RecoveryResendOpen
+	// RecoveryUSBReset resets the dongle's USB port
+	RecoveryUSBReset
+	// RecoveryReconnect tears down and re-establishes the whole connection
+	RecoveryReconnect
+)
+
+// String returns the string representation of the recovery step
+func (r RecoveryStep) String() string {
+	switch r {
+	case RecoveryNone:
+		return "none"
+	case RecoveryResendOpen:
+		return "resend_open"
+	case RecoveryUSBReset:
+		return "usb_reset"
+	case RecoveryReconnect:
+		return "reconnect"
+	default:
+		return "unknown"
+	}
+}
+
+// Watchdog detects a dongle that stays enumerated but stops responding,
+// and escalates from re-sending Open, to a USB port reset, to a full reconnect
+type Watchdog struct {
+	stateManager *StateManager
+	mu           sync.Mutex
+	timeout      time.Duration
+	idleTimeout  time.Duration
+	step         RecoveryStep
+	stepAt       time.Time
+	stopChan     chan struct{}
+	doneChan     chan struct{}
+	running      bool
+
+	onReconnect func()
+	onRecovery  func(step RecoveryStep)
+}
+
+// NewWatchdog creates a new watchdog using DefaultLivenessTimeout
+func NewWatchdog(stateManager *StateManager) *Watchdog {
+	return &Watchdog{
+		stateManager: stateManager,
+		timeout:      DefaultLivenessTimeout,
+		idleTimeout:  DefaultIdleLivenessTimeout,
+	}
+}
+
+// SetTimeout sets how long the dongle may stay silent before each escalation step
+func (w *Watchdog) SetTimeout(timeout time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if timeout > 0 {
+		w.timeout = timeout
+	}
+}
+
+// SetIdleTimeout sets how long the dongle may stay silent while no phone is attached
+func (w *Watchdog) SetIdleTimeout(timeout time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if timeout > 0 {
+		w.idleTimeout = timeout
+	}
+}
+
+// SetCallbacks sets the full reconnect handler and the recovery step observer
+func (w *Watchdog) SetCallbacks(onReconnect func(), onRecovery func(step RecoveryStep)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onReconnect = onReconnect
+	w.onRecovery = onRecovery
+}
+
+// Start begins liveness monitoring
+func (w *Watchdog) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running {
+		return
+	}
+	w.running = true
+	// Fresh channels, Stop closes them
+	w.stopChan = make(chan struct{})
+	w.doneChan = make(chan struct{})
+	go w.run(w.stopChan, w.doneChan)
+	logger("watchdog").Infof("Started (timeout %v, %v without a phone)", w.timeout, w.idleTimeout)
+}
+
+// Stop stops liveness monitoring
+func (w *Watchdog) Stop() {
+	w.mu.Lock()
+	if !w.running {
+		w.mu.Unlock()
+		return
+	}
+	w.running = false
+	stopChan, doneChan := w.stopChan, w.doneChan
+	w.mu.Unlock()
+
+	close(stopChan)
+	<-doneChan
+	logger("watchdog").Info("Stopped")
+}
+
+func (w *Watchdog) run(stopChan, doneChan chan struct{}) {
+	defer close(doneChan)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// check evaluates the time since the last received message and escalates if needed.
+// Without a phone attached the longer idle timeout applies.
+func (w *Watchdog) check() {
+	state := w.stateManager.GetState()
+	if state != StateConnected && state != StateRecovering {
+		// Nothing to watch; forget any recovery in progress
+		w.mu.Lock()
+		w.step = RecoveryNone
+		w.mu.Unlock()
+		return
+	}
+
+	w.mu.Lock()
+	timeout := w.timeout
+	if !PhoneAttached() {
+		timeout = w.idleTimeout
+	}
+	step := w.step
+	stepAt := w.stepAt
+	w.mu.Unlock()
+
+	silence := time.Since(LastReceived())
+	if silence < timeout {
+		if step != RecoveryNone {
+			logger("watchdog").Infof("Dongle responsive again after %v", step)
+			w.setStep(RecoveryNone)
+			w.stateManager.SetState(StateConnected)
+		}
+		return
+	}
+
+	// Give the previous step a full timeout to take effect
+	if step != RecoveryNone && time.Since(stepAt) < timeout {
+		return
+	}
+
+	if step >= RecoveryReconnect {
+		step = RecoveryNone
+	}
+	w.escalate(step+1, silence)
+}
+
+// escalate performs the given recovery step
+func (w *Watchdog) escalate(step RecoveryStep, silence time.Duration) {
+	logger("watchdog").Infof("No message from dongle for %v, recovery step: %v", silence.Round(time.Millisecond), step)
+	w.setStep(step)
+
+	switch step {
+	case RecoveryResendOpen:
+		w.stateManager.SetState(StateRecovering)
+		if err := ResendOpen(); err != nil {
+			logger("watchdog").Errorf("Failed to re-send Open: %v", err)
+		}
+	case RecoveryUSBReset:
+		w.stateManager.SetState(StateRecovering)
+		if err := ResetDevice(); err != nil {
+			logger("watchdog").Warnf("USB reset failed: %v", err)
+		}
+	case RecoveryReconnect:
+		w.mu.Lock()
+		onReconnect := w.onReconnect
+		w.mu.Unlock()
+		if onReconnect != nil {
+			// Reconnect blocks until the new connection attempt is started
+			onReconnect()
+		}
+		w.setStep(RecoveryNone)
+	}
+}
+
+// setStep records the current step and notifies the recovery observer
+func (w *Watchdog) setStep(step RecoveryStep) {
+	w.mu.Lock()
+	changed := w.step != step
+	w.step = step
+	w.stepAt = time.Now()
+	onRecovery := w.onRecovery
+	w.mu.Unlock()
+
+	if changed && onRecovery != nil {
+		onRecovery(step)
+	}
+}
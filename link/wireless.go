@@ -0,0 +1,409 @@
+package link
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mzyy94/gocarplay"
+	"github.com/mzyy94/gocarplay/protocol"
+)
+
+// Wireless connection defaults
+const (
+	WifiConnectDelay      = 600 * time.Millisecond // Delay after configuration before the first WifiConnect
+	DefaultWifiMinBackoff = 2 * time.Second
+	DefaultWifiMaxBackoff = 60 * time.Second
+)
+
+// WirelessStatus is the state of the wireless phone session
+type WirelessStatus int
+
+const (
+	// WirelessDisabled indicates wireless CarPlay/Android Auto is turned off
+	WirelessDisabled WirelessStatus = iota
+	// WirelessIdle indicates no connection attempt is in progress
+	WirelessIdle
+	// WirelessScanning indicates the dongle is scanning for phones
+	WirelessScanning
+	// WirelessConnecting indicates a phone was found and the dongle is connecting
+	WirelessConnecting
+	// WirelessConnected indicates a phone is connected over WiFi
+	WirelessConnected
+	// WirelessRetrying indicates the last attempt failed and a retry is scheduled
+	WirelessRetrying
+)
+
+// String returns the string representation of the wireless status
+func (s WirelessStatus) String() string {
+	switch s {
+	case WirelessDisabled:
+		return "disabled"
+	case WirelessIdle:
+		return "idle"
+	case WirelessScanning:
+		return "scanning"
+	case WirelessConnecting:
+		return "connecting"
+	case WirelessConnected:
+		return "connected"
+	case WirelessRetrying:
+		return "retrying"
+	default:
+		return "unknown"
+	}
+}
+
+// WirelessInfo is a snapshot of the wireless session
+type WirelessInfo struct {
+	Status     WirelessStatus
+	DeviceName string        // WiFi name reported by the dongle
+	LastPhone  string        // Bluetooth address of the last wirelessly connected phone
+	Attempts   int           // Failed attempts since the last successful connection
+	NextRetry  time.Duration // Backoff before the scheduled retry, if retrying
+	Preference string        // Why the preferred phone was not applied, "" if it was or there is none
+}
+
+// WirelessManager drives wireless phone connections and retries failed attempts with backoff
+type WirelessManager struct {
+	mu         sync.Mutex
+	bluetooth  *BluetoothManager
+	selector   *PhoneSelector
+	enabled    bool
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	backoff    time.Duration
+	info       WirelessInfo
+	timer      *time.Timer
+	generation int  // Invalidates timers scheduled before the last Stop
+	ended      bool // The session ended on purpose, a disconnect is not retried
+	listeners  []chan WirelessInfo
+}
+
+// NewWirelessManager creates a new wireless manager for the given configuration
+func NewWirelessManager(config *gocarplay.DongleConfig, bluetooth *BluetoothManager) *WirelessManager {
+	wm := &WirelessManager{
+		bluetooth:  bluetooth,
+		enabled:    config.WirelessEnabled,
+		minBackoff: DefaultWifiMinBackoff,
+		maxBackoff: DefaultWifiMaxBackoff,
+		listeners:  make([]chan WirelessInfo, 0),
+	}
+	if config.WifiRetryMinBackoff > 0 {
+		wm.minBackoff = time.Duration(config.WifiRetryMinBackoff) * time.Millisecond
+	}
+	if config.WifiRetryMaxBackoff > 0 {
+		wm.maxBackoff = time.Duration(config.WifiRetryMaxBackoff) * time.Millisecond
+	}
+	if wm.maxBackoff < wm.minBackoff {
+		wm.maxBackoff = wm.minBackoff
+	}
+	wm.backoff = wm.minBackoff
+	if wm.enabled {
+		wm.info.Status = WirelessIdle
+	}
+	return wm
+}
+
+// SetPhoneSelector makes connection attempts follow the auto-connect policy
+// instead of only preferring the last connected phone
+func (wm *WirelessManager) SetPhoneSelector(selector *PhoneSelector) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.selector = selector
+}
+
+// GetInfo returns a snapshot of the wireless session
+func (wm *WirelessManager) GetInfo() WirelessInfo {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return wm.info
+}
+
+// Begin starts the first wireless connection attempt once the dongle is configured
+func (wm *WirelessManager) Begin() {
+	wm.mu.Lock()
+	if !wm.enabled {
+		wm.mu.Unlock()
+		return
+	}
+	wm.backoff = wm.minBackoff
+	wm.ended = false
+	wm.info.Attempts = 0
+	wm.mu.Unlock()
+
+	wm.schedule(WifiConnectDelay)
+}
+
+// Stop cancels pending retries, e.g. after the dongle is detached
+func (wm *WirelessManager) Stop() {
+	wm.cancel()
+	wm.mu.Lock()
+	wm.ended = false
+	wm.mu.Unlock()
+
+	wm.update(func(info *WirelessInfo) {
+		info.DeviceName = ""
+		info.Attempts = 0
+		info.NextRetry = 0
+		if info.Status != WirelessDisabled {
+			info.Status = WirelessIdle
+		}
+	})
+}
+
+// HandleEvent updates the wireless session from a dispatched dongle event
+func (wm *WirelessManager) HandleEvent(event Event) {
+	if !wm.isEnabled() {
+		return
+	}
+
+	switch event := event.(type) {
+	case DeviceSearchEvent:
+		switch event.Status {
+		case SearchScanning:
+			wm.setStatus(WirelessScanning)
+		case SearchDeviceFound:
+			wm.setStatus(WirelessConnecting)
+		case SearchDeviceNotFound, SearchConnectFailed:
+			wm.retry()
+		}
+	case WifiEvent:
+		if event.Connected {
+			wm.connected()
+		} else if wm.hasEnded() {
+			wm.setStatus(WirelessIdle)
+		} else if wm.GetInfo().Status != WirelessRetrying {
+			// An Unplugged may already have scheduled the retry
+			wm.retry()
+		}
+	}
+}
+
+// Disconnect ends the wireless session on purpose, without retrying
+func (wm *WirelessManager) Disconnect() error {
+	wm.end()
+	logger("wireless").Info("Disconnecting phone")
+	return DisconnectPhone()
+}
+
+// end marks the session as ended on purpose and cancels pending retries
+func (wm *WirelessManager) end() {
+	wm.cancel()
+	wm.mu.Lock()
+	wm.ended = true
+	wm.mu.Unlock()
+	wm.update(func(info *WirelessInfo) {
+		info.NextRetry = 0
+		if info.Status != WirelessDisabled {
+			info.Status = WirelessIdle
+		}
+	})
+}
+
+// cancel invalidates the pending connection attempt
+func (wm *WirelessManager) cancel() {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.generation++
+	if wm.timer != nil {
+		wm.timer.Stop()
+		wm.timer = nil
+	}
+}
+
+// hasEnded reports whether the session ended on purpose
+func (wm *WirelessManager) hasEnded() bool {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return wm.ended
+}
+
+// HandleMessage updates the wireless session from a received dongle message.
+// It returns false if the message is not wireless related.
+func (wm *WirelessManager) HandleMessage(msg interface{}) bool {
+	switch msg := msg.(type) {
+	case *protocol.WifiDeviceName:
+		wm.update(func(info *WirelessInfo) {
+			info.DeviceName = trimNullTerm(msg.Data)
+		})
+	case *protocol.Unplugged:
+		// A phone dropping off unexpectedly is reconnected, unless Disconnect ended the session
+		if wm.isEnabled() && !wm.hasEnded() && wm.GetInfo().Status == WirelessConnected {
+			wm.retry()
+		}
+	case *protocol.BoxSettings:
+		if report, err := msg.Report(); err == nil && report.Phone != nil {
+			wm.phoneReported(report.Phone.BtMacAddr)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// connected records a successful connection and resets the backoff
+func (wm *WirelessManager) connected() {
+	wm.mu.Lock()
+	wm.backoff = wm.minBackoff
+	wm.ended = false
+	wm.mu.Unlock()
+
+	wm.update(func(info *WirelessInfo) {
+		info.Status = WirelessConnected
+		info.Attempts = 0
+		info.NextRetry = 0
+	})
+}
+
+// phoneReported records the Bluetooth address the connected phone reported
+// about itself as the last wirelessly connected phone
+func (wm *WirelessManager) phoneReported(address string) {
+	if address == "" || wm.GetInfo().Status != WirelessConnected {
+		return
+	}
+
+	wm.mu.Lock()
+	selector := wm.selector
+	wm.mu.Unlock()
+
+	if selector != nil {
+		selector.RecordConnected(address)
+	}
+	wm.update(func(info *WirelessInfo) {
+		info.LastPhone = address
+	})
+}
+
+// retry schedules the next connection attempt with exponential backoff
+func (wm *WirelessManager) retry() {
+	wm.mu.Lock()
+	delay := wm.backoff
+	wm.backoff *= 2
+	if wm.backoff > wm.maxBackoff {
+		wm.backoff = wm.maxBackoff
+	}
+	wm.mu.Unlock()
+
+	wm.update(func(info *WirelessInfo) {
+		info.Status = WirelessRetrying
+		info.Attempts++
+		info.NextRetry = delay
+	})
+	logger("wireless").Warnf("Connection attempt failed, retrying in %v", delay)
+	wm.schedule(delay)
+}
+
+// schedule sends WifiConnect after delay, replacing any pending attempt
+func (wm *WirelessManager) schedule(delay time.Duration) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	if wm.timer != nil {
+		wm.timer.Stop()
+	}
+	generation := wm.generation
+	wm.timer = time.AfterFunc(delay, func() {
+		wm.mu.Lock()
+		current := wm.generation == generation
+		wm.mu.Unlock()
+		if current {
+			wm.connect()
+		}
+	})
+}
+
+// connect asks the dongle to connect, preferring the phones chosen by the
+// auto-connect policy, or the last connected phone without a policy.
+// Whether the preference was applied is reported in WirelessInfo.Preference.
+func (wm *WirelessManager) connect() {
+	wm.mu.Lock()
+	selector := wm.selector
+	wm.mu.Unlock()
+
+	lastPhone := wm.GetInfo().LastPhone
+	var preferred []string
+	if selector != nil {
+		if !selector.AutoConnectAllowed() {
+			logger("wireless").Info("Waiting for phone selection before connecting")
+			wm.setStatus(WirelessIdle)
+			return
+		}
+		preferred = selector.Preferred()
+	} else if lastPhone != "" {
+		preferred = []string{lastPhone}
+	}
+
+	// The dongle picks the phone by itself unless the paired list can be reordered
+	preference := ""
+	if len(preferred) > 0 && wm.bluetooth != nil {
+		if err := wm.bluetooth.Prioritize(preferred); err != nil {
+			preference = err.Error()
+			logger("wireless").Debugf("Phone preference not applied: %v", err)
+		}
+	}
+	wm.update(func(info *WirelessInfo) {
+		info.Preference = preference
+	})
+
+	logger("wireless").Info("Requesting WiFi connection")
+	if err := SendCommand(protocol.WifiConnect); err != nil {
+		logger("wireless").Errorf("Failed to send WifiConnect: %v", err)
+	}
+}
+
+func (wm *WirelessManager) isEnabled() bool {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return wm.enabled
+}
+
+func (wm *WirelessManager) setStatus(status WirelessStatus) {
+	wm.update(func(info *WirelessInfo) {
+		info.Status = status
+	})
+}
+
+// update applies fn to the wireless session and notifies listeners on change
+func (wm *WirelessManager) update(fn func(info *WirelessInfo)) {
+	wm.mu.Lock()
+	old := wm.info
+	fn(&wm.info)
+	info := wm.info
+	listeners := wm.listeners
+	wm.mu.Unlock()
+
+	if old == info {
+		return
+	}
+	for _, ch := range listeners {
+		select {
+		case ch <- info:
+		default:
+			// Skip if channel is full
+		}
+	}
+}
+
+// Subscribe creates a new channel that will receive wireless session notifications
+func (wm *WirelessManager) Subscribe() chan WirelessInfo {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	ch := make(chan WirelessInfo, 10)
+	wm.listeners = append(wm.listeners, ch)
+	return ch
+}
+
+// Unsubscribe removes a listener channel
+func (wm *WirelessManager) Unsubscribe(ch chan WirelessInfo) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	for i, listener := range wm.listeners {
+		if listener == ch {
+			wm.listeners = append(wm.listeners[:i], wm.listeners[i+1:]...)
+			close(ch)
+			break
+		}
+	}
+}
@@ -0,0 +1,291 @@
+// Package logging provides leveled loggers with per-component levels.
+// Output is either human-readable text or one JSON object per line.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log message
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the string representation of the level
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseLevel parses a level name
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level: %s", name)
+}
+
+// Format selects the output encoding
+type Format string
+
+const (
+	// FormatText writes "time LEVEL [component] message key=value" lines
+	FormatText Format = "text"
+	// FormatJSON writes one JSON object per line
+	FormatJSON Format = "json"
+)
+
+// core is the output and level configuration shared by all loggers derived from one root
+type core struct {
+	mu           sync.RWMutex
+	out          io.Writer
+	format       Format
+	defaultLevel Level
+	levels       map[string]Level // Per-component overrides
+	named        map[string]*Logger
+	writeMu      sync.Mutex // Serializes writes so lines from concurrent loggers do not interleave
+}
+
+// Logger writes leveled messages for one component
+type Logger struct {
+	core      *core
+	component string
+	fields    []field
+}
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+// New creates a root logger writing to out
+func New(out io.Writer, format Format, level Level) *Logger {
+	c := &core{
+		out:          out,
+		format:       format,
+		defaultLevel: level,
+		levels:       make(map[string]Level),
+		named:        make(map[string]*Logger),
+	}
+	return &Logger{core: c}
+}
+
+var defaultLogger = New(os.Stderr, FormatText, LevelInfo)
+
+// Default returns the process-wide root logger
+func Default() *Logger {
+	return defaultLogger
+}
+
+// Named returns the logger for a component. Loggers are cached per component.
+func (l *Logger) Named(component string) *Logger {
+	c := l.core
+	c.mu.RLock()
+	named, ok := c.named[component]
+	c.mu.RUnlock()
+	if ok && len(l.fields) == 0 {
+		return named
+	}
+
+	named = &Logger{core: c, component: component, fields: l.fields}
+	if len(l.fields) == 0 {
+		c.mu.Lock()
+		c.named[component] = named
+		c.mu.Unlock()
+	}
+	return named
+}
+
+// With returns a logger that adds the key/value field to every message
+func (l *Logger) With(key string, value interface{}) *Logger {
+	fields := make([]field, len(l.fields), len(l.fields)+1)
+	copy(fields, l.fields)
+	return &Logger{core: l.core, component: l.component, fields: append(fields, field{key, value})}
+}
+
+// Component returns the component name of the logger
+func (l *Logger) Component() string {
+	return l.component
+}
+
+// SetFormat changes the output encoding of all loggers sharing this root
+func (l *Logger) SetFormat(format Format) {
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+	l.core.format = format
+}
+
+// SetLevel sets the level of a component, or the default level if component is empty
+func (l *Logger) SetLevel(component string, level Level) {
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+	if component == "" {
+		l.core.defaultLevel = level
+	} else {
+		l.core.levels[component] = level
+	}
+}
+
+// ResetLevel makes a component use the default level again
+func (l *Logger) ResetLevel(component string) {
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+	delete(l.core.levels, component)
+}
+
+// Levels returns the default level and the per-component overrides
+func (l *Logger) Levels() (Level, map[string]Level) {
+	l.core.mu.RLock()
+	defer l.core.mu.RUnlock()
+	levels := make(map[string]Level, len(l.core.levels))
+	for component, level := range l.core.levels {
+		levels[component] = level
+	}
+	return l.core.defaultLevel, levels
+}
+
+// Components returns the names of all components that have logged or have a level set
+func (l *Logger) Components() []string {
+	l.core.mu.RLock()
+	defer l.core.mu.RUnlock()
+	seen := make(map[string]bool)
+	for component := range l.core.named {
+		seen[component] = true
+	}
+	for component := range l.core.levels {
+		seen[component] = true
+	}
+	components := make([]string, 0, len(seen))
+	for component := range seen {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	return components
+}
+
+// Enabled reports whether messages of the level are written for this component
+func (l *Logger) Enabled(level Level) bool {
+	l.core.mu.RLock()
+	defer l.core.mu.RUnlock()
+	min, ok := l.core.levels[l.component]
+	if !ok {
+		min = l.core.defaultLevel
+	}
+	return level >= min
+}
+
+// Debugf logs a debug message
+func (l *Logger) Debugf(format string, args ...interface{}) { l.logf(LevelDebug, format, args...) }
+
+// Infof logs an informational message
+func (l *Logger) Infof(format string, args ...interface{}) { l.logf(LevelInfo, format, args...) }
+
+// Warnf logs a warning
+func (l *Logger) Warnf(format string, args ...interface{}) { l.logf(LevelWarn, format, args...) }
+
+// Errorf logs an error
+func (l *Logger) Errorf(format string, args ...interface{}) { l.logf(LevelError, format, args...) }
+
+// Fatalf logs an error and exits the process
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.write(LevelError, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// Debug logs a debug message
+func (l *Logger) Debug(msg string) { l.log(LevelDebug, msg) }
+
+// Info logs an informational message
+func (l *Logger) Info(msg string) { l.log(LevelInfo, msg) }
+
+// Warn logs a warning
+func (l *Logger) Warn(msg string) { l.log(LevelWarn, msg) }
+
+// Error logs an error
+func (l *Logger) Error(msg string) { l.log(LevelError, msg) }
+
+func (l *Logger) logf(level Level, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.write(level, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) log(level Level, msg string) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.write(level, msg)
+}
+
+func (l *Logger) write(level Level, msg string) {
+	now := time.Now()
+
+	l.core.mu.RLock()
+	out := l.core.out
+	format := l.core.format
+	l.core.mu.RUnlock()
+
+	var line []byte
+	if format == FormatJSON {
+		entry := map[string]interface{}{
+			"time":  now.Format(time.RFC3339Nano),
+			"level": level.String(),
+			"msg":   msg,
+		}
+		if l.component != "" {
+			entry["component"] = l.component
+		}
+		for _, f := range l.fields {
+			entry[f.key] = f.value
+		}
+		line, _ = json.Marshal(entry)
+		line = append(line, '\n')
+	} else {
+		var b strings.Builder
+		b.WriteString(now.Format("2006/01/02 15:04:05 "))
+		fmt.Fprintf(&b, "%-5s ", strings.ToUpper(level.String()))
+		if l.component != "" {
+			fmt.Fprintf(&b, "[%s] ", l.component)
+		}
+		b.WriteString(msg)
+		for _, f := range l.fields {
+			fmt.Fprintf(&b, " %s=%v", f.key, f.value)
+		}
+		b.WriteByte('\n')
+		line = []byte(b.String())
+	}
+
+	l.core.writeMu.Lock()
+	out.Write(line)
+	l.core.writeMu.Unlock()
+}
@@ -0,0 +1,175 @@
+// Package metrics provides counters and gauges exposed in the Prometheus text format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	value uint64
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+// Add increments the counter by n
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.value, n)
+}
+
+// Value returns the current counter value
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	bits uint64
+}
+
+// Set sets the gauge value
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+// Value returns the current gauge value
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+// CounterVec is a set of counters partitioned by the value of one label
+type CounterVec struct {
+	mu       sync.RWMutex
+	counters map[string]*Counter
+}
+
+// With returns the counter for the label value, creating it if needed
+func (v *CounterVec) With(label string) *Counter {
+	v.mu.RLock()
+	c, ok := v.counters[label]
+	v.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok = v.counters[label]; !ok {
+		c = &Counter{}
+		v.counters[label] = c
+	}
+	return c
+}
+
+// Delete removes the counter for the label value, e.g. for a disconnected client
+func (v *CounterVec) Delete(label string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.counters, label)
+}
+
+// metric is a registered metric family
+type metric struct {
+	name  string
+	help  string
+	kind  string // "counter" or "gauge"
+	label string // Label name for vectors
+	write func(w io.Writer, m *metric)
+}
+
+var registry []*metric
+var registryMutex sync.Mutex
+
+func register(m *metric) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registry = append(registry, m)
+}
+
+// NewCounter registers a counter
+func NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	register(&metric{name: name, help: help, kind: "counter", write: func(w io.Writer, m *metric) {
+		fmt.Fprintf(w, "%s %d\n", m.name, c.Value())
+	}})
+	return c
+}
+
+// NewCounterFunc registers a counter whose value is read from fn
+func NewCounterFunc(name, help string, fn func() uint64) {
+	register(&metric{name: name, help: help, kind: "counter", write: func(w io.Writer, m *metric) {
+		fmt.Fprintf(w, "%s %d\n", m.name, fn())
+	}})
+}
+
+// NewCounterVec registers a counter partitioned by label
+func NewCounterVec(name, help, label string) *CounterVec {
+	v := &CounterVec{counters: make(map[string]*Counter)}
+	register(&metric{name: name, help: help, kind: "counter", label: label, write: func(w io.Writer, m *metric) {
+		v.mu.RLock()
+		labels := make([]string, 0, len(v.counters))
+		for l := range v.counters {
+			labels = append(labels, l)
+		}
+		v.mu.RUnlock()
+		sort.Strings(labels)
+
+		for _, l := range labels {
+			fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", m.name, m.label, escapeLabel(l), v.With(l).Value())
+		}
+	}})
+	return v
+}
+
+// NewGauge registers a gauge
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{}
+	register(&metric{name: name, help: help, kind: "gauge", write: func(w io.Writer, m *metric) {
+		fmt.Fprintf(w, "%s %g\n", m.name, g.Value())
+	}})
+	return g
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn
+func NewGaugeFunc(name, help string, fn func() float64) {
+	register(&metric{name: name, help: help, kind: "gauge", write: func(w io.Writer, m *metric) {
+		fmt.Fprintf(w, "%s %g\n", m.name, fn())
+	}})
+}
+
+// WriteText writes all registered metrics in the Prometheus text format
+func WriteText(w io.Writer) {
+	registryMutex.Lock()
+	list := append([]*metric(nil), registry...)
+	registryMutex.Unlock()
+
+	for _, m := range list {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+		m.write(w, m)
+	}
+}
+
+// Handler serves the registered metrics
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteText(w)
+	})
+}
+
+func escapeLabel(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
@@ -0,0 +1,110 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AirplayOption is an airplay.conf entry without a dedicated AirplayConfig field
+type AirplayOption struct {
+	Key   string
+	Value string
+}
+
+// AirplayConfig is the content of FileAddressAirplayConfig.
+// The file consists of "key = value" lines.
+type AirplayConfig struct {
+	OEMIconVisible bool
+	Name           string // Accessory name reported to the phone
+	Model          string // Accessory model reported to the phone
+	OEMIconPath    string
+	OEMIconLabel   string          // Omitted if empty
+	Extra          []AirplayOption // Other options, written in order after the known ones
+}
+
+// airplayKeys are the keys written from AirplayConfig fields
+var airplayKeys = map[string]bool{
+	"oemIconVisible": true,
+	"name":           true,
+	"model":          true,
+	"oemIconPath":    true,
+	"oemIconLabel":   true,
+}
+
+// IsAirplayKey reports whether key is written from an AirplayConfig field
+// and therefore cannot be set through Extra
+func IsAirplayKey(key string) bool {
+	return airplayKeys[key]
+}
+
+// Marshal serializes the config with the known keys first, in a fixed order.
+// Extra options named like a known key, or repeating an earlier option, are skipped.
+func (c *AirplayConfig) Marshal() []byte {
+	var buf bytes.Buffer
+	write := func(key, value string) {
+		fmt.Fprintf(&buf, "%s = %s\n", key, value)
+	}
+
+	visible := "0"
+	if c.OEMIconVisible {
+		visible = "1"
+	}
+	write("oemIconVisible", visible)
+	write("name", c.Name)
+	write("model", c.Model)
+	write("oemIconPath", c.OEMIconPath)
+	if c.OEMIconLabel != "" {
+		write("oemIconLabel", c.OEMIconLabel)
+	}
+	written := map[string]bool{}
+	for _, option := range c.Extra {
+		if IsAirplayKey(option.Key) || written[option.Key] {
+			continue
+		}
+		written[option.Key] = true
+		write(option.Key, option.Value)
+	}
+	return buf.Bytes()
+}
+
+// ParseAirplayConfig parses airplay.conf content.
+// Unknown keys are kept in Extra in file order; empty lines and # comments are skipped.
+func ParseAirplayConfig(data []byte) (*AirplayConfig, error) {
+	config := &AirplayConfig{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		i := strings.Index(text, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("airplay.conf line %d: missing '='", line)
+		}
+		key := strings.TrimSpace(text[:i])
+		value := strings.TrimSpace(text[i+1:])
+
+		switch key {
+		case "oemIconVisible":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("airplay.conf line %d: invalid oemIconVisible: %s", line, value)
+			}
+			config.OEMIconVisible = n != 0
+		case "name":
+			config.Name = value
+		case "model":
+			config.Model = value
+		case "oemIconPath":
+			config.OEMIconPath = value
+		case "oemIconLabel":
+			config.OEMIconLabel = value
+		default:
+			config.Extra = append(config.Extra, AirplayOption{Key: key, Value: value})
+		}
+	}
+	return config, scanner.Err()
+}
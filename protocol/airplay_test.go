@@ -0,0 +1,124 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAirplayConfigRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		config AirplayConfig
+	}{
+		{
+			name: "defaults",
+			config: AirplayConfig{
+				OEMIconVisible: true,
+				Name:           "AutoBox",
+				Model:          "GoCarPlay-1.00",
+				OEMIconPath:    string(FileAddressOEMIcon),
+			},
+		},
+		{
+			name: "label and extra options",
+			config: AirplayConfig{
+				OEMIconVisible: true,
+				Name:           "Scooter",
+				Model:          "S1",
+				OEMIconPath:    string(FileAddressOEMIcon),
+				OEMIconLabel:   "My Scooter",
+				Extra:          []AirplayOption{{Key: "zeta", Value: "1"}, {Key: "alpha", Value: "a = b"}},
+			},
+		},
+		{
+			name: "hidden icon",
+			config: AirplayConfig{
+				Name:        "AutoBox",
+				Model:       "GoCarPlay-1.00",
+				OEMIconPath: string(FileAddressOEMIcon),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseAirplayConfig(tt.config.Marshal())
+			if err != nil {
+				t.Fatalf("ParseAirplayConfig: %v", err)
+			}
+			if !reflect.DeepEqual(*parsed, tt.config) {
+				t.Errorf("round trip mismatch\n got: %+v\nwant: %+v", *parsed, tt.config)
+			}
+		})
+	}
+}
+
+func TestAirplayConfigSkipsCollidingOptions(t *testing.T) {
+	config := AirplayConfig{
+		OEMIconVisible: true,
+		Name:           "AutoBox",
+		Model:          "GoCarPlay-1.00",
+		OEMIconPath:    string(FileAddressOEMIcon),
+		Extra: []AirplayOption{
+			{Key: "name", Value: "Other"},
+			{Key: "model", Value: "Other"},
+			{Key: "custom", Value: "first"},
+			{Key: "custom", Value: "second"},
+		},
+	}
+
+	parsed, err := ParseAirplayConfig(config.Marshal())
+	if err != nil {
+		t.Fatalf("ParseAirplayConfig: %v", err)
+	}
+	if parsed.Name != "AutoBox" || parsed.Model != "GoCarPlay-1.00" {
+		t.Errorf("typed fields overridden: name %q, model %q", parsed.Name, parsed.Model)
+	}
+	want := []AirplayOption{{Key: "custom", Value: "first"}}
+	if !reflect.DeepEqual(parsed.Extra, want) {
+		t.Errorf("extra = %+v, want %+v", parsed.Extra, want)
+	}
+}
+
+func TestParseAirplayConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    AirplayConfig
+		wantErr bool
+	}{
+		{
+			name: "comments, blank lines and spacing",
+			data: "# generated\n\noemIconVisible=1\n  name =  AutoBox  \nmodel = M\n",
+			want: AirplayConfig{OEMIconVisible: true, Name: "AutoBox", Model: "M"},
+		},
+		{
+			name:    "missing separator",
+			data:    "oemIconVisible 1\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid visibility",
+			data:    "oemIconVisible = yes\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseAirplayConfig([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", parsed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAirplayConfig: %v", err)
+			}
+			if !reflect.DeepEqual(*parsed, tt.want) {
+				t.Errorf("got %+v, want %+v", *parsed, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// BoxSettingsConfig is the JSON configuration sent to the dongle in BoxSettings
+type BoxSettingsConfig struct {
+	MediaDelay       int32  `json:"mediaDelay"` // Audio buffering delay in ms
+	SyncTime         int64  `json:"syncTime"`   // Wall-clock time for the dongle
+	AndroidAutoSizeW int32  `json:"androidAutoSizeW"`
+	AndroidAutoSizeH int32  `json:"androidAutoSizeH"`
+	WiFiChannel      int32  `json:"WiFiChannel"` // Both spellings are read by different firmwares
+	WifiChannel      int32  `json:"wifiChannel"`
+	MediaSound       *int32 `json:"mediaSound,omitempty"`  // Media sample rate option, firmware default if nil
+	CallQuality      *int32 `json:"callQuality,omitempty"` // Call audio quality option, firmware default if nil
+	AutoConn         *bool  `json:"autoConn,omitempty"`    // Auto-connect to known phones, firmware default if nil
+
+	NaviScreenInfo *NaviScreenInfo `json:"naviScreenInfo,omitempty"` // Requests NaviVideoData, not requested if nil
+}
+
+// BoxSettingsUpdate changes individual settings of a configured dongle
+// without resending the whole BoxSettingsConfig
+type BoxSettingsUpdate struct {
+	SyncTime *int64 `json:"syncTime,omitempty"`
+	AutoConn *bool  `json:"autoConn,omitempty"`
+}
+
+// NaviScreenInfo describes the secondary navigation screen, e.g. an instrument cluster
+type NaviScreenInfo struct {
+	Width  int32 `json:"width"`
+	Height int32 `json:"height"`
+	Fps    int32 `json:"fps"`
+}
+
+// DongleDevice is an entry of the device list reported in BoxSettings
+type DongleDevice struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Index string `json:"index"`
+	Time  string `json:"time"`
+}
+
+// BoxInfo is the dongle information reported in BoxSettings
+type BoxInfo struct {
+	UUID        string         `json:"uuid,omitempty"`
+	MFD         string         `json:"mfd,omitempty"` // Manufacturing date
+	BoxType     string         `json:"box_type,omitempty"`
+	OemName     string         `json:"oem_name,omitempty"`
+	ProductType string         `json:"product_type,omitempty"`
+	HwVersion   string         `json:"hw_version,omitempty"`
+	WiFiChannel int32          `json:"wifi_channel,omitempty"`
+	Devices     []DongleDevice `json:"devices,omitempty"`
+}
+
+// PhoneInfo is the connected phone information reported in BoxSettings
+type PhoneInfo struct {
+	LinkType    string `json:"link_type,omitempty"` // e.g. "CarPlay"
+	Model       string `json:"model,omitempty"`
+	OSVersion   string `json:"os_version,omitempty"`
+	LinkVersion string `json:"link_version,omitempty"`
+	BtMacAddr   string `json:"bt_mac_addr,omitempty"`
+	BtName      string `json:"bt_name,omitempty"`
+}
+
+// BoxSettingsReport is the parsed content of a BoxSettings message from the dongle.
+// The dongle reports its own info and the connected phone's info in separate messages.
+type BoxSettingsReport struct {
+	Box   *BoxInfo               // Set if the message describes the dongle
+	Phone *PhoneInfo             // Set if the message describes the connected phone
+	Raw   map[string]interface{} // All reported keys
+}
+
+// NewBoxSettings builds a BoxSettings message carrying the configuration
+func NewBoxSettings(config *BoxSettingsConfig) (*BoxSettings, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return &BoxSettings{Settings: data}, nil
+}
+
+// NewBoxSettingsUpdate builds a BoxSettings message holding only the set fields
+func NewBoxSettingsUpdate(update *BoxSettingsUpdate) (*BoxSettings, error) {
+	data, err := json.Marshal(update)
+	if err != nil {
+		return nil, err
+	}
+	return &BoxSettings{Settings: data}, nil
+}
+
+// Report parses the dongle-reported settings
+func (s *BoxSettings) Report() (*BoxSettingsReport, error) {
+	report := &BoxSettingsReport{}
+	if err := json.Unmarshal(s.Settings, &report.Raw); err != nil {
+		return nil, fmt.Errorf("invalid box settings: %v", err)
+	}
+
+	str := func(key string) string {
+		if v, ok := report.Raw[key]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+
+	if _, ok := report.Raw["uuid"]; ok {
+		box := &BoxInfo{
+			UUID:        str("uuid"),
+			MFD:         str("MFD"),
+			BoxType:     str("boxType"),
+			OemName:     str("OemName"),
+			ProductType: str("productType"),
+			HwVersion:   str("hwVersion"),
+		}
+		if channel, ok := report.Raw["WiFiChannel"].(float64); ok {
+			box.WiFiChannel = int32(channel)
+		}
+		if list, ok := report.Raw["DevList"].([]interface{}); ok {
+			for _, entry := range list {
+				device, ok := entry.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				field := func(key string) string {
+					if v, ok := device[key]; ok && v != nil {
+						return fmt.Sprint(v)
+					}
+					return ""
+				}
+				box.Devices = append(box.Devices, DongleDevice{
+					ID:    field("id"),
+					Type:  field("type"),
+					Name:  field("name"),
+					Index: field("index"),
+					Time:  field("time"),
+				})
+			}
+		}
+		report.Box = box
+	}
+
+	if _, ok := report.Raw["MDModel"]; ok {
+		report.Phone = &PhoneInfo{
+			LinkType:    str("MDLinkType"),
+			Model:       str("MDModel"),
+			OSVersion:   str("MDOSVersion"),
+			LinkVersion: str("MDLinkVersion"),
+			BtMacAddr:   str("btMacAddr"),
+			BtName:      str("btName"),
+		}
+	}
+	return report, nil
+}
+
+func (s *BoxSettings) pack(buffer io.Writer) error {
+	_, err := buffer.Write(s.Settings)
+	return err
+}
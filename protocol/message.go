@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"reflect"
 
@@ -12,32 +13,53 @@ import (
 
 const magicNumber uint32 = 0x55aa55aa
 
+// messageTypes maps payloads to their message type IDs. The network MAC address,
+// GNSS, navigation video and navigation focus IDs follow the MessageType enum
+// of pi-carplay (github.com/f-io/pi-carplay). DayNightMode (0x1a), the UI
+// messages (0x25, 0x26) and VehicleInfo (0x2b) are not confirmed by a public
+// source yet. The service never sends them, except VehicleInfo when enabled.
 var messageTypes = map[reflect.Type]uint32{
-	reflect.TypeOf(&SendFile{}):            0x99,
-	reflect.TypeOf(&Open{}):                0x01,
-	reflect.TypeOf(&Opened{}):              0x01,
-	reflect.TypeOf(&Heartbeat{}):           0xaa,
-	reflect.TypeOf(&ManufacturerInfo{}):    0x14,
-	reflect.TypeOf(&CarPlay{}):             0x08,
-	reflect.TypeOf(&SoftwareVersion{}):     0xcc,
-	reflect.TypeOf(&BluetoothAddress{}):    0x0a,
-	reflect.TypeOf(&BluetoothPIN{}):        0x0c,
-	reflect.TypeOf(&Plugged{}):             0x02,
-	reflect.TypeOf(&Unplugged{}):           0x04,
-	reflect.TypeOf(&VideoData{}):           0x06,
-	reflect.TypeOf(&AudioData{}):           0x07,
-	reflect.TypeOf(&Touch{}):               0x05,
-	reflect.TypeOf(&BluetoothDeviceName{}): 0x0d,
-	reflect.TypeOf(&WifiDeviceName{}):      0x0e,
-	reflect.TypeOf(&BluetoothPairedList{}): 0x12,
-	reflect.TypeOf(&MultiTouch{}):          0x17,
-	reflect.TypeOf(&Phase{}):               0x03,
-	reflect.TypeOf(&HiCarLink{}):           0x18,
-	reflect.TypeOf(&BoxSettings{}):         0x19,
-	reflect.TypeOf(&MediaData{}):           0x2a,
-	reflect.TypeOf(&LogoTypeMsg{}):         0x09,
-	reflect.TypeOf(&DisconnectPhone{}):     0x0f,
-	reflect.TypeOf(&CloseDongle{}):         0x15,
+	reflect.TypeOf(&SendFile{}):             0x99,
+	reflect.TypeOf(&Open{}):                 0x01,
+	reflect.TypeOf(&Opened{}):               0x01,
+	reflect.TypeOf(&Heartbeat{}):            0xaa,
+	reflect.TypeOf(&ManufacturerInfo{}):     0x14,
+	reflect.TypeOf(&CarPlay{}):              0x08,
+	reflect.TypeOf(&SoftwareVersion{}):      0xcc,
+	reflect.TypeOf(&BluetoothAddress{}):     0x0a,
+	reflect.TypeOf(&BluetoothPIN{}):         0x0c,
+	reflect.TypeOf(&Plugged{}):              0x02,
+	reflect.TypeOf(&Unplugged{}):            0x04,
+	reflect.TypeOf(&VideoData{}):            0x06,
+	reflect.TypeOf(&AudioData{}):            0x07,
+	reflect.TypeOf(&Touch{}):                0x05,
+	reflect.TypeOf(&BluetoothDeviceName{}):  0x0d,
+	reflect.TypeOf(&WifiDeviceName{}):       0x0e,
+	reflect.TypeOf(&BluetoothPairedList{}):  0x12,
+	reflect.TypeOf(&MultiTouch{}):           0x17,
+	reflect.TypeOf(&Phase{}):                0x03,
+	reflect.TypeOf(&HiCarLink{}):            0x18,
+	reflect.TypeOf(&BoxSettings{}):          0x19,
+	reflect.TypeOf(&MediaData{}):            0x2a,
+	reflect.TypeOf(&LogoTypeMsg{}):          0x09,
+	reflect.TypeOf(&DisconnectPhone{}):      0x0f,
+	reflect.TypeOf(&CloseDongle{}):          0x15,
+	reflect.TypeOf(&DayNightMode{}):         0x1a,
+	reflect.TypeOf(&NetworkMacAddress{}):    0x23,
+	reflect.TypeOf(&NetworkMacAddressAlt{}): 0x24,
+	reflect.TypeOf(&UIHidePeerInfo{}):       0x25,
+	reflect.TypeOf(&UIBringToForeground{}):  0x26,
+	reflect.TypeOf(&GnssData{}):             0x29,
+	reflect.TypeOf(&VehicleInfo{}):          0x2b,
+	reflect.TypeOf(&NaviVideoData{}):        0x2c,
+	reflect.TypeOf(&NaviFocusRequest{}):     0x6e,
+	reflect.TypeOf(&NaviFocusRelease{}):     0x6f,
+}
+
+// receivedTypes resolves message types shared by several payloads to the
+// payload sent by the dongle, e.g. Opened rather than Open
+var receivedTypes = map[uint32]reflect.Type{
+	0x01: reflect.TypeOf(&Opened{}),
 }
 
 // Header is header structure of data protocol
@@ -48,7 +70,22 @@ type Header struct {
 	TypeN  uint32 `struc:"uint32,little"`
 }
 
+// payloadUnpacker is implemented by payloads whose wire format varies, e.g.
+// between firmware builds, so struc cannot unpack them
+type payloadUnpacker interface {
+	unpack(data []byte) error
+}
+
+// payloadPacker is implemented by payloads whose wire format struc cannot describe,
+// typically because their variable-length data is tagged struc:"skip"
+type payloadPacker interface {
+	pack(buffer io.Writer) error
+}
+
 func packPayload(buffer io.Writer, payload interface{}) error {
+	if packer, ok := payload.(payloadPacker); ok {
+		return packer.pack(buffer)
+	}
 	if reflect.ValueOf(payload).Elem().NumField() > 0 {
 		return struc.Pack(buffer, payload)
 	}
@@ -81,7 +118,53 @@ func Marshal(payload interface{}) ([]byte, error) {
 	return buffer.Bytes(), err
 }
 
+// MessageName returns the name of the payload type, e.g. "VideoData"
+func MessageName(payload interface{}) string {
+	if unknown, ok := payload.(*Unknown); ok {
+		return fmt.Sprintf("Unknown(0x%02x)", unknown.Type)
+	}
+	t := reflect.TypeOf(payload)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// DescribePayload formats the payload via GoString, summarizing bulky data.
+// It reports whether the payload carries video or audio.
+func DescribePayload(payload interface{}) (string, bool) {
+	switch payload := payload.(type) {
+	case *VideoData:
+		return fmt.Sprintf("&protocol.VideoData{Width:%d, Height:%d, Flags:%d, Length:%d, Data:<%d bytes>}",
+			payload.Width, payload.Height, payload.Flags, payload.Length, len(payload.Data)), true
+	case *NaviVideoData:
+		return fmt.Sprintf("&protocol.NaviVideoData{Width:%d, Height:%d, Flags:%d, Length:%d, Data:<%d bytes>}",
+			payload.Width, payload.Height, payload.Flags, payload.Length, len(payload.Data)), true
+	case *AudioData:
+		if len(payload.Data) > 0 {
+			return fmt.Sprintf("&protocol.AudioData{DecodeType:%d, Volume:%g, AudioType:%d, Data:<%d bytes>}",
+				payload.DecodeType, payload.Volume, payload.AudioType, len(payload.Data)), true
+		}
+	case *MediaData:
+		if payload.Type == MediaTypeAlbumCover {
+			return fmt.Sprintf("&protocol.MediaData{Type:%d, MediaInfo:<%d bytes>}", payload.Type, len(payload.MediaInfo)), true
+		}
+		return fmt.Sprintf("&protocol.MediaData{Type:%d, MediaInfo:%q}", payload.Type, payload.MediaInfo), false
+	case *SendFile:
+		return fmt.Sprintf("&protocol.SendFile{FileName:%#v, Content:<%d bytes>}", payload.FileName, len(payload.Content)), false
+	case *Unknown:
+		if len(payload.Data) > 64 {
+			return fmt.Sprintf("&protocol.Unknown{Type:0x%02x, Data:<%d bytes> % x ...}", payload.Type, len(payload.Data), payload.Data[:64]), false
+		}
+		return fmt.Sprintf("&protocol.Unknown{Type:0x%02x, Data:% x}", payload.Type, payload.Data), false
+	}
+	return fmt.Sprintf("%#v", payload), false
+}
+
 func GetPayloadByHeader(hdr Header) interface{} {
+	if key, found := receivedTypes[hdr.Type]; found {
+		return reflect.New(key.Elem()).Interface()
+	}
 	for key, value := range messageTypes {
 		if value == hdr.Type {
 			return reflect.New(key.Elem()).Interface()
@@ -91,6 +174,9 @@ func GetPayloadByHeader(hdr Header) interface{} {
 }
 
 func Unmarshal(data []byte, payload interface{}) error {
+	if unpacker, ok := payload.(payloadUnpacker); ok {
+		return unpacker.unpack(data)
+	}
 	if len(data) > 0 {
 		err := struc.Unpack(bytes.NewBuffer(data), payload)
 		if err != nil {
@@ -142,6 +228,14 @@ func Unmarshal(data []byte, payload interface{}) error {
 		payload.Data = NullTermString(data)
 	case *HiCarLink:
 		payload.Link = NullTermString(data)
+	case *NetworkMacAddress:
+		payload.Address = NullTermString(data)
+	case *NetworkMacAddressAlt:
+		payload.Address = NullTermString(data)
+	case *GnssData:
+		payload.Data = data
+	case *VehicleInfo:
+		payload.Info = data
 	case *BoxSettings:
 		payload.Settings = data
 	case *MediaData:
@@ -0,0 +1,187 @@
+package protocol
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// decode unpacks a marshalled message the way the link layer reads it from the dongle
+func decode(t *testing.T, data []byte) (Header, interface{}) {
+	t.Helper()
+
+	var header Header
+	if err := Unmarshal(data[:16], &header); err != nil {
+		t.Fatalf("Unmarshal header: %v", err)
+	}
+	if int(header.Length) != len(data)-16 {
+		t.Fatalf("header length %d, payload is %d bytes", header.Length, len(data)-16)
+	}
+
+	payload := GetPayloadByHeader(header)
+	if err := Unmarshal(data[16:], payload); err != nil {
+		t.Fatalf("Unmarshal payload: %v", err)
+	}
+	return header, payload
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload interface{}
+		typeID  uint32
+	}{
+		{
+			name:    "navigation video",
+			payload: &NaviVideoData{Width: 800, Height: 480, Flags: 2, Length: 4, Data: []byte{0, 0, 0, 1}},
+			typeID:  0x2c,
+		},
+		{
+			name:    "navigation focus request",
+			payload: &NaviFocusRequest{},
+			typeID:  0x6e,
+		},
+		{
+			name:    "navigation focus release",
+			payload: &NaviFocusRelease{},
+			typeID:  0x6f,
+		},
+		{
+			name:    "day/night mode",
+			payload: &DayNightMode{Mode: NightMode},
+			typeID:  0x1a,
+		},
+		{
+			name:    "hide peer info",
+			payload: &UIHidePeerInfo{},
+			typeID:  0x25,
+		},
+		{
+			name:    "bring UI to foreground",
+			payload: &UIBringToForeground{},
+			typeID:  0x26,
+		},
+		{
+			name:    "network MAC address",
+			payload: &NetworkMacAddress{Address: "aa:bb:cc:dd:ee:ff\x00"},
+			typeID:  0x23,
+		},
+		{
+			name:    "alternate network MAC address",
+			payload: &NetworkMacAddressAlt{Address: "aa:bb:cc:dd:ee:ff\x00"},
+			typeID:  0x24,
+		},
+		{
+			name:    "GNSS data",
+			payload: NewGnssData([]string{"$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A"}),
+			typeID:  0x29,
+		},
+		{
+			name:    "vehicle info",
+			payload: &VehicleInfo{Info: []byte(`{"speed":12.5}`)},
+			typeID:  0x2b,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Marshal(tt.payload)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			header, payload := decode(t, data)
+			if header.Type != tt.typeID {
+				t.Errorf("type = 0x%02x, want 0x%02x", header.Type, tt.typeID)
+			}
+			if !reflect.DeepEqual(payload, tt.payload) {
+				t.Errorf("round trip mismatch\n got: %#v\nwant: %#v", payload, tt.payload)
+			}
+		})
+	}
+}
+
+func TestGnssDataSentences(t *testing.T) {
+	want := []string{"$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47", "$GPRMC,123519,A*6A"}
+	gnss := NewGnssData([]string{want[0] + "\r\n", want[1]})
+	if got := gnss.Sentences(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sentences = %q, want %q", got, want)
+	}
+}
+
+func TestVehicleInfoData(t *testing.T) {
+	speed := 12.5
+	battery := int32(80)
+	msg, err := NewVehicleInfo(&VehicleInfoData{Speed: &speed, BatteryLevel: &battery})
+	if err != nil {
+		t.Fatalf("NewVehicleInfo: %v", err)
+	}
+	if string(msg.Info) != `{"speed":12.5,"batteryLevel":80}` {
+		t.Errorf("info = %s", msg.Info)
+	}
+
+	msg.Info = append(msg.Info, 0)
+	data, err := msg.Data()
+	if err != nil {
+		t.Fatalf("Data: %v", err)
+	}
+	if data.Speed == nil || *data.Speed != speed || data.BatteryLevel == nil || *data.BatteryLevel != battery || data.Range != nil {
+		t.Errorf("data = %+v", data)
+	}
+}
+
+func TestOpenDirection(t *testing.T) {
+	open := &Open{Width: 800, Height: 480, VideoFrameRate: 30, Format: 5, PacketMax: 49152, IBoxVersion: 2, PhoneWorkMode: 2}
+	data, err := Marshal(open)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	// The dongle answers Open with the same type ID, which decodes as Opened
+	header, payload := decode(t, data)
+	if header.Type != 0x01 {
+		t.Errorf("type = 0x%02x, want 0x01", header.Type)
+	}
+	want := &Opened{Width: 800, Height: 480, Fps: 30, Format: 5, PacketMax: 49152, IBox: 2, PhoneMode: 2}
+	if !reflect.DeepEqual(payload, want) {
+		t.Errorf("got %#v, want %#v", payload, want)
+	}
+}
+
+func TestOpenedVariants(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want *Opened
+	}{
+		{
+			name: "short",
+			data: []byte{0x20, 0x03, 0, 0, 0xe0, 0x01, 0, 0},
+			want: &Opened{Width: 800, Height: 480},
+		},
+		{
+			name: "trailing fields",
+			data: append(bytes.Repeat([]byte{1, 0, 0, 0}, 7), 9, 9),
+			want: &Opened{Width: 1, Height: 1, Fps: 1, Format: 1, PacketMax: 1, IBox: 1, PhoneMode: 1, Extra: []byte{9, 9}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opened := &Opened{}
+			if err := Unmarshal(tt.data, opened); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(opened, tt.want) {
+				t.Fatalf("got %#v, want %#v", opened, tt.want)
+			}
+
+			var buf bytes.Buffer
+			if err := packPayload(&buf, opened); err != nil {
+				t.Fatalf("pack: %v", err)
+			}
+			if tt.want.Extra != nil && !bytes.Equal(buf.Bytes(), tt.data) {
+				t.Errorf("packed % x, want % x", buf.Bytes(), tt.data)
+			}
+		})
+	}
+}
@@ -1,5 +1,13 @@
 package protocol
 
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/lunixbochs/struc"
+)
+
 type SendFile struct {
 	FileNameSize int32 `struc:"int32,little,sizeof=FileName"`
 	FileName     NullTermString
@@ -67,6 +75,18 @@ type AudioData struct {
 	Data           []byte       `struc:"skip"`
 }
 
+func (a *AudioData) pack(buffer io.Writer) error {
+	if err := struc.Pack(buffer, a); err != nil {
+		return err
+	}
+	if len(a.Data) == 0 && a.Command != 0 {
+		_, err := buffer.Write([]byte{byte(a.Command)})
+		return err
+	}
+	_, err := buffer.Write(a.Data)
+	return err
+}
+
 type Touch struct {
 	Action TouchAction `struc:"int32,little"`
 	X      uint32      `struc:"uint32,little"`
@@ -97,6 +117,69 @@ type BluetoothPairedList struct {
 	Data NullTermString `struc:"skip"`
 }
 
+// PairedDevice is an entry of the dongle's Bluetooth paired list
+type PairedDevice struct {
+	Address string `json:"address"`
+	Name    string `json:"name"`
+}
+
+// bluetoothAddressLength is the length of a textual address, e.g. "AA:BB:CC:DD:EE:FF"
+const bluetoothAddressLength = 17
+
+// Devices parses the paired list. The format is undocumented; lines are
+// expected to hold a device address immediately followed by the device name,
+// and lines not starting with an address are skipped.
+func (l *BluetoothPairedList) Devices() []PairedDevice {
+	var devices []PairedDevice
+	for _, line := range strings.Split(strings.TrimRight(string(l.Data), "\x00"), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) < bluetoothAddressLength || !isBluetoothAddress(line[:bluetoothAddressLength]) {
+			continue
+		}
+		devices = append(devices, PairedDevice{
+			Address: line[:bluetoothAddressLength],
+			Name:    strings.TrimSpace(line[bluetoothAddressLength:]),
+		})
+	}
+	return devices
+}
+
+// isBluetoothAddress reports whether s is a textual address, e.g. "AA:BB:CC:DD:EE:FF"
+func isBluetoothAddress(s string) bool {
+	if len(s) != bluetoothAddressLength {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if i%3 == 2 {
+			if c != ':' {
+				return false
+			}
+			continue
+		}
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// NewBluetoothPairedList builds a paired list message from devices in priority order
+func NewBluetoothPairedList(devices []PairedDevice) *BluetoothPairedList {
+	var buf strings.Builder
+	for _, device := range devices {
+		buf.WriteString(device.Address)
+		buf.WriteString(device.Name)
+		buf.WriteString("\n")
+	}
+	return &BluetoothPairedList{Data: NullTermString(buf.String())}
+}
+
+func (l *BluetoothPairedList) pack(buffer io.Writer) error {
+	_, err := io.WriteString(buffer, string(l.Data)+"\x00")
+	return err
+}
+
 type Unknown struct {
 	Type uint32 `struc:"skip"`
 	Data []byte `struc:"skip"`
@@ -115,6 +198,38 @@ type Opened struct {
 	PacketMax     int32 `struc:"int32,little"`
 	IBox          int32 `struc:"int32,little"`
 	PhoneMode     int32 `struc:"int32,little"`
+	Extra         []byte `struc:"skip"` // Trailing fields sent by some firmware builds
+}
+
+// openedFields lists the fields of Opened in wire order
+func (o *Opened) openedFields() []*int32 {
+	return []*int32{&o.Width, &o.Height, &o.Fps, &o.Format, &o.PacketMax, &o.IBox, &o.PhoneMode}
+}
+
+// unpack accepts the shorter and longer Opened variants sent by some firmware
+// builds: missing fields stay zero and trailing bytes are kept in Extra
+func (o *Opened) unpack(data []byte) error {
+	for _, field := range o.openedFields() {
+		if len(data) < 4 {
+			break
+		}
+		*field = int32(binary.LittleEndian.Uint32(data))
+		data = data[4:]
+	}
+	if len(data) > 0 {
+		o.Extra = append([]byte(nil), data...)
+	}
+	return nil
+}
+
+func (o *Opened) pack(buffer io.Writer) error {
+	for _, field := range o.openedFields() {
+		if err := binary.Write(buffer, binary.LittleEndian, *field); err != nil {
+			return err
+		}
+	}
+	_, err := buffer.Write(o.Extra)
+	return err
 }
 
 type BoxSettings struct {
@@ -122,7 +237,7 @@ type BoxSettings struct {
 }
 
 type Phase struct {
-	PhaseValue uint32 `struc:"int32,little"`
+	PhaseValue PhaseType `struc:"int32,little"`
 }
 
 type HiCarLink struct {
@@ -142,3 +257,53 @@ type CloseDongle struct {
 type SendIconConfig struct {
 	Config []byte `struc:"skip"`
 }
+
+// NaviVideoData is the secondary navigation video stream, e.g. the
+// instrument cluster map. It uses the same layout as VideoData.
+type NaviVideoData VideoData
+
+func (v *NaviVideoData) unpack(data []byte) error {
+	return Unmarshal(data, (*VideoData)(v))
+}
+
+// NaviFocusRequest is sent by the dongle when the phone wants to show
+// navigation on the secondary screen
+type NaviFocusRequest struct {
+}
+
+// NaviFocusRelease is sent by the dongle when navigation leaves the secondary screen
+type NaviFocusRelease struct {
+}
+
+// UIHidePeerInfo asks the host to hide the connecting phone's details
+type UIHidePeerInfo struct {
+}
+
+// UIBringToForeground asks the host to show the projection UI
+type UIBringToForeground struct {
+}
+
+// DayNightMode reports or sets the day/night appearance
+type DayNightMode struct {
+	Mode DayNightModeType `struc:"int32,little"`
+}
+
+// NetworkMacAddress is the phone's network MAC address, sent for HiCar sessions
+type NetworkMacAddress struct {
+	Address NullTermString `struc:"skip"`
+}
+
+func (m *NetworkMacAddress) pack(buffer io.Writer) error {
+	_, err := io.WriteString(buffer, string(m.Address))
+	return err
+}
+
+// NetworkMacAddressAlt is the alternate form of NetworkMacAddress
+type NetworkMacAddressAlt struct {
+	Address NullTermString `struc:"skip"`
+}
+
+func (m *NetworkMacAddressAlt) pack(buffer io.Writer) error {
+	_, err := io.WriteString(buffer, string(m.Address))
+	return err
+}
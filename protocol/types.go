@@ -258,6 +258,52 @@ func (p PhoneType) String() string {
 	}
 }
 
+// PhaseType is the session phase reported by the dongle. Only the values below
+// are known; others are kept as received and shown as unknown(n).
+type PhaseType uint32
+
+const (
+	// PhaseUnknown is not sent by the dongle, it marks that no Phase was received yet
+	PhaseUnknown           = PhaseType(0xffffffff)
+	PhaseIdle              = PhaseType(0)
+	PhaseConnecting        = PhaseType(7)
+	PhaseRunning           = PhaseType(8)
+	PhaseNegotiationFailed = PhaseType(13)
+)
+
+func (p PhaseType) String() string {
+	switch p {
+	case PhaseUnknown:
+		return "unknown"
+	case PhaseIdle:
+		return "idle"
+	case PhaseConnecting:
+		return "connecting"
+	case PhaseRunning:
+		return "running"
+	case PhaseNegotiationFailed:
+		return "negotiation_failed"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint32(p))
+	}
+}
+
+func (p PhaseType) GoString() string {
+	switch p {
+	case PhaseUnknown:
+		return "PhaseUnknown"
+	case PhaseIdle:
+		return "PhaseIdle"
+	case PhaseConnecting:
+		return "PhaseConnecting"
+	case PhaseRunning:
+		return "PhaseRunning"
+	case PhaseNegotiationFailed:
+		return "PhaseNegotiationFailed"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint32(p))
+}
+
 type MediaType uint32
 
 const (
@@ -280,6 +326,23 @@ const (
 	LogoSiri       = LogoType(2)
 )
 
+type DayNightModeType uint32
+
+const (
+	DayMode   = DayNightModeType(0)
+	NightMode = DayNightModeType(1)
+)
+
+func (m DayNightModeType) GoString() string {
+	switch m {
+	case DayMode:
+		return "DayMode"
+	case NightMode:
+		return "NightMode"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint32(m))
+}
+
 type HandDriveType uint32
 
 const (
@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// GnssData carries NMEA 0183 sentences forwarded to the phone, which newer
+// firmware uses to improve navigation accuracy
+type GnssData struct {
+	Data []byte `struc:"skip"`
+}
+
+// NewGnssData builds a GNSS message from NMEA sentences, e.g. "$GPRMC,..."
+func NewGnssData(sentences []string) *GnssData {
+	var buf strings.Builder
+	for _, sentence := range sentences {
+		buf.WriteString(strings.TrimRight(sentence, "\r\n"))
+		buf.WriteString("\r\n")
+	}
+	return &GnssData{Data: []byte(buf.String())}
+}
+
+// Sentences returns the NMEA sentences of the message
+func (g *GnssData) Sentences() []string {
+	var sentences []string
+	for _, line := range strings.Split(strings.TrimRight(string(g.Data), "\x00"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			sentences = append(sentences, line)
+		}
+	}
+	return sentences
+}
+
+func (g *GnssData) pack(buffer io.Writer) error {
+	_, err := buffer.Write(g.Data)
+	return err
+}
+
+// VehicleInfoData is the JSON payload of a VehicleInfo message.
+// Fields left nil are not sent. Neither the 0x2b message nor these keys are
+// documented by the dongle vendor or a public implementation; they are what
+// this project sends when vehicle forwarding is enabled, not a confirmed format.
+type VehicleInfoData struct {
+	Speed        *float64 `json:"speed,omitempty"`        // km/h
+	BatteryLevel *int32   `json:"batteryLevel,omitempty"` // State of charge in percent
+	Range        *int32   `json:"range,omitempty"`        // Remaining range in km
+	NightMode    *bool    `json:"nightMode,omitempty"`
+}
+
+// VehicleInfo carries vehicle state to the phone as JSON
+type VehicleInfo struct {
+	Info []byte `struc:"skip"`
+}
+
+// NewVehicleInfo builds a vehicle info message
+func NewVehicleInfo(data *VehicleInfoData) (*VehicleInfo, error) {
+	info, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return &VehicleInfo{Info: info}, nil
+}
+
+// Data parses the vehicle info payload
+func (v *VehicleInfo) Data() (*VehicleInfoData, error) {
+	data := &VehicleInfoData{}
+	if err := json.Unmarshal([]byte(strings.TrimRight(string(v.Info), "\x00")), data); err != nil {
+		return nil, fmt.Errorf("invalid vehicle info: %v", err)
+	}
+	return data, nil
+}
+
+func (v *VehicleInfo) pack(buffer io.Writer) error {
+	_, err := buffer.Write(v.Info)
+	return err
+}
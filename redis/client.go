@@ -3,8 +3,8 @@ package redis
 import (
 	"context"
 	"fmt"
-	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -16,6 +16,8 @@ const (
 	HealthCheckInterval = 10 * time.Second
 	ReconnectMinBackoff = 1 * time.Second
 	ReconnectMaxBackoff = 30 * time.Second
+	CommandList         = "scooter:carplay" // List the service pops commands from
+	CommandPollTimeout  = 1 * time.Second
 )
 
 type Client struct {
@@ -30,6 +32,11 @@ type Client struct {
 	// Health check management
 	stopChan chan struct{}
 	doneChan chan struct{}
+
+	// Background listeners (command queue, subscriptions)
+	listeners sync.WaitGroup
+
+	publishFailures uint64 // State changes that could not be published
 }
 
 // NewClient creates a new Redis client for the carplay service
@@ -67,9 +74,9 @@ func NewClient(addr string) *Client {
 		client.mu.Lock()
 		client.connected = true
 		client.mu.Unlock()
-		log.Println("[Redis] Initial connection successful")
+		logger().Info("Initial connection successful")
 	} else {
-		log.Printf("[Redis] Initial connection failed: %v (will retry in background)", err)
+		logger().Warnf("Initial connection failed: %v (will retry in background)", err)
 	}
 
 	// Start background health check
@@ -86,12 +93,12 @@ func (c *Client) startHealthCheck() {
 		ticker := time.NewTicker(HealthCheckInterval)
 		defer ticker.Stop()
 
-		log.Println("[Redis] Health check started")
+		logger().Info("Health check started")
 
 		for {
 			select {
 			case <-c.stopChan:
-				log.Println("[Redis] Health check stopped")
+				logger().Info("Health check stopped")
 				return
 			case <-ticker.C:
 				// Ping Redis to check connectivity
@@ -103,26 +110,26 @@ func (c *Client) startHealthCheck() {
 
 				if err != nil {
 					if wasConnected {
-						log.Printf("[Redis] Connection lost: %v", err)
+						logger().Warnf("Connection lost: %v", err)
 						c.mu.Lock()
 						c.connected = false
 						c.mu.Unlock()
 					}
 
 					// Attempt reconnection
-					log.Println("[Redis] Attempting reconnection...")
+					logger().Info("Attempting reconnection...")
 					if c.reconnect() {
 						c.mu.Lock()
 						c.connected = true
 						c.mu.Unlock()
-						log.Println("[Redis] Reconnected successfully")
+						logger().Info("Reconnected successfully")
 					} else {
-						log.Println("[Redis] Reconnection failed, will retry later")
+						logger().Warn("Reconnection failed, will retry later")
 					}
 				} else {
 					// Successfully pinged
 					if !wasConnected {
-						log.Println("[Redis] Connection restored")
+						logger().Info("Connection restored")
 						c.mu.Lock()
 						c.connected = true
 						c.mu.Unlock()
@@ -139,7 +146,7 @@ func (c *Client) reconnect() bool {
 	backoff := ReconnectMinBackoff
 
 	for attempt := 1; ; attempt++ {
-		log.Printf("[Redis] Reconnection attempt %d...", attempt)
+		logger().Infof("Reconnection attempt %d...", attempt)
 
 		// Try to ping
 		err := c.Ping()
@@ -147,7 +154,7 @@ func (c *Client) reconnect() bool {
 			return true
 		}
 
-		log.Printf("[Redis] Attempt %d failed: %v", attempt, err)
+		logger().Warnf("Attempt %d failed: %v", attempt, err)
 
 		// Wait before next attempt
 		time.Sleep(backoff)
@@ -176,7 +183,8 @@ func (c *Client) PublishState(key, value string) {
 
 	// Check connection state
 	if !c.isConnected() {
-		log.Printf("[Redis] Not connected, skipping publish: %s.%s = %s", HashName, key, value)
+		logger().Warnf("Not connected, skipping publish: %s.%s = %s", HashName, key, value)
+		atomic.AddUint64(&c.publishFailures, 1)
 		return
 	}
 
@@ -186,7 +194,8 @@ func (c *Client) PublishState(key, value string) {
 	// HSET carplay <key> <value>
 	err := c.rdb.HSet(ctx, HashName, key, value).Err()
 	if err != nil {
-		log.Printf("[Redis] Failed to HSET %s %s=%s: %v", HashName, key, value, err)
+		logger().Errorf("Failed to HSET %s %s=%s: %v", HashName, key, value, err)
+		atomic.AddUint64(&c.publishFailures, 1)
 		// Mark as disconnected so health check will attempt reconnection
 		c.mu.Lock()
 		c.connected = false
@@ -197,7 +206,8 @@ func (c *Client) PublishState(key, value string) {
 	// PUBLISH carplay <key>
 	err = c.rdb.Publish(ctx, HashName, key).Err()
 	if err != nil {
-		log.Printf("[Redis] Failed to PUBLISH %s %s: %v", HashName, key, err)
+		logger().Errorf("Failed to PUBLISH %s %s: %v", HashName, key, err)
+		atomic.AddUint64(&c.publishFailures, 1)
 		// Mark as disconnected so health check will attempt reconnection
 		c.mu.Lock()
 		c.connected = false
@@ -205,7 +215,40 @@ func (c *Client) PublishState(key, value string) {
 		return
 	}
 
-	log.Printf("[Redis] Published: %s.%s = %s", HashName, key, value)
+	logger().Infof("Published: %s.%s = %s", HashName, key, value)
+}
+
+// PushEvent prepends an entry to a list trimmed to the newest max entries
+func (c *Client) PushEvent(list, entry string, max int64) {
+	if c == nil || c.rdb == nil {
+		return
+	}
+
+	if !c.isConnected() {
+		logger().Warnf("Not connected, skipping event: %s", list)
+		atomic.AddUint64(&c.publishFailures, 1)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, PublishTimeout)
+	defer cancel()
+
+	// LPUSH <list> <entry>; LTRIM <list> 0 <max-1>
+	pipe := c.rdb.TxPipeline()
+	pipe.LPush(ctx, list, entry)
+	pipe.LTrim(ctx, list, 0, max-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger().Errorf("Failed to push event to %s: %v", list, err)
+		atomic.AddUint64(&c.publishFailures, 1)
+	}
+}
+
+// PublishFailures returns the number of state changes that could not be published
+func (c *Client) PublishFailures() uint64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&c.publishFailures)
 }
 
 // Close closes the Redis connection and stops the health check
@@ -214,7 +257,7 @@ func (c *Client) Close() error {
 		return nil
 	}
 
-	log.Println("[Redis] Closing connection...")
+	logger().Info("Closing connection...")
 
 	// Stop health check goroutine
 	if c.stopChan != nil {
@@ -223,10 +266,13 @@ func (c *Client) Close() error {
 		<-c.doneChan
 	}
 
+	// Wait for background listeners to notice the stop signal
+	c.listeners.Wait()
+
 	// Close Redis connection
 	if c.rdb != nil {
 		if err := c.rdb.Close(); err != nil {
-			log.Printf("[Redis] Error closing connection: %v", err)
+			logger().Errorf("Error closing connection: %v", err)
 			return err
 		}
 	}
@@ -235,7 +281,7 @@ func (c *Client) Close() error {
 	c.connected = false
 	c.mu.Unlock()
 
-	log.Println("[Redis] Connection closed")
+	logger().Info("Connection closed")
 	return nil
 }
 
@@ -250,3 +296,117 @@ func (c *Client) Ping() error {
 
 	return c.rdb.Ping(ctx).Err()
 }
+
+// ListenCommands pops commands from CommandList and passes them to handler
+// until the client is closed. Commands are plain strings such as "bt-pair",
+// pushed with: LPUSH scooter:carplay <command>
+func (c *Client) ListenCommands(handler func(command string)) {
+	if c == nil || c.rdb == nil {
+		return
+	}
+
+	c.listeners.Add(1)
+	go func() {
+		defer c.listeners.Done()
+
+		logger().Infof("Listening for commands on %s", CommandList)
+		for {
+			select {
+			case <-c.stopChan:
+				return
+			default:
+			}
+
+			if !c.isConnected() {
+				time.Sleep(CommandPollTimeout)
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(c.ctx, CommandPollTimeout+PublishTimeout)
+			result, err := c.rdb.BRPop(ctx, CommandPollTimeout, CommandList).Result()
+			cancel()
+			if err == redis.Nil {
+				continue // Timeout without command
+			}
+			if err != nil {
+				logger().Errorf("Failed to pop command: %v", err)
+				time.Sleep(CommandPollTimeout)
+				continue
+			}
+
+			// BRPOP returns [list, value]
+			if len(result) == 2 {
+				logger().Infof("Received command: %s", result[1])
+				handler(result[1])
+			}
+		}
+	}()
+}
+
+// HGetAll returns all fields of a hash
+func (c *Client) HGetAll(hash string) (map[string]string, error) {
+	if c == nil || c.rdb == nil {
+		return nil, fmt.Errorf("redis client not initialized")
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, PublishTimeout)
+	defer cancel()
+
+	return c.rdb.HGetAll(ctx, hash).Result()
+}
+
+// Subscribe calls handler with the payload of every message published on channel
+// until the client is closed
+func (c *Client) Subscribe(channel string, handler func(payload string)) {
+	if c == nil || c.rdb == nil {
+		return
+	}
+
+	pubsub := c.rdb.Subscribe(c.ctx, channel)
+	c.listeners.Add(1)
+	go func() {
+		defer c.listeners.Done()
+		defer pubsub.Close()
+
+		logger().Infof("Subscribed to %s", channel)
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-c.stopChan:
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				handler(msg.Payload)
+			}
+		}
+	}()
+}
+
+// WatchHash calls handler with all fields of hash whenever a change is published
+// on the channel of the same name, following the HSET <hash> + PUBLISH <hash> <field>
+// pattern. The handler is also called once with the current content.
+func (c *Client) WatchHash(hash string, handler func(fields map[string]string)) {
+	if c == nil || c.rdb == nil {
+		return
+	}
+
+	notify := func() {
+		fields, err := c.HGetAll(hash)
+		if err != nil {
+			logger().Errorf("Failed to read %s: %v", hash, err)
+			return
+		}
+		if len(fields) > 0 {
+			handler(fields)
+		}
+	}
+
+	if c.isConnected() {
+		notify()
+	}
+	c.Subscribe(hash, func(string) {
+		notify()
+	})
+}
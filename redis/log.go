@@ -0,0 +1,24 @@
+package redis
+
+import (
+	"sync"
+
+	"github.com/mzyy94/gocarplay/logging"
+)
+
+var baseLogger = logging.Default()
+var loggerMutex sync.RWMutex
+
+// SetLogger makes the redis package log through l, as component "redis"
+func SetLogger(l *logging.Logger) {
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+	baseLogger = l
+}
+
+// logger returns the redis component logger
+func logger() *logging.Logger {
+	loggerMutex.RLock()
+	defer loggerMutex.RUnlock()
+	return baseLogger.Named("redis")
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/mzyy94/gocarplay/logging"
+)
+
+// Store is a small JSON file backed key-value store for state that must
+// survive service restarts, such as the phone auto-connect policy
+type Store struct {
+	mu   sync.Mutex
+	path string
+	data map[string]json.RawMessage
+}
+
+// Open loads the store at path. A missing file yields an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path: path,
+		data: make(map[string]json.RawMessage),
+	}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		logging.Default().Named("store").Infof("No state file at %s, starting empty", path)
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &s.data); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// Get decodes the value stored under key into v.
+// It returns false if the key does not exist.
+func (s *Store) Get(key string, v interface{}) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+
+	s.mu.Lock()
+	raw, ok := s.data[key]
+	s.mu.Unlock()
+
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// Set stores v under key and writes the store to disk
+func (s *Store) Set(key string, v interface{}) error {
+	if s == nil {
+		return nil
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data[key] = raw
+	return s.save()
+}
+
+// save writes the store atomically via a temporary file; the caller holds mu
+func (s *Store) save() error {
+	content, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}